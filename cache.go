@@ -0,0 +1,52 @@
+package oniontree
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+type serviceCacheEntry struct {
+	modTime time.Time
+	size    int64
+	service *Service
+}
+
+// serviceCache holds parsed services keyed by ID. An entry is valid only
+// as long as modification time and size of the service file don't change.
+type serviceCache struct {
+	sync.RWMutex
+	entries map[string]*serviceCacheEntry
+}
+
+func (c *serviceCache) get(id string, fi os.FileInfo) (*Service, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	entry, ok := c.entries[id]
+	if !ok || !entry.modTime.Equal(fi.ModTime()) || entry.size != fi.Size() {
+		return nil, false
+	}
+	return entry.service.clone(), true
+}
+
+func (c *serviceCache) put(id string, fi os.FileInfo, s *Service) {
+	c.Lock()
+	c.entries[id] = &serviceCacheEntry{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		service: s.clone(),
+	}
+	c.Unlock()
+}
+
+func (c *serviceCache) invalidate(id string) {
+	c.Lock()
+	delete(c.entries, id)
+	c.Unlock()
+}
+
+func newServiceCache() *serviceCache {
+	return &serviceCache{
+		entries: make(map[string]*serviceCacheEntry),
+	}
+}
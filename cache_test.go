@@ -0,0 +1,96 @@
+package oniontree_test
+
+import (
+	"fmt"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestOnionTree_GetServiceCached(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ot.EnableCache()
+
+	service, err := ot.GetService("oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Modifying the returned service must not affect the cache.
+	service.Name = "Modified"
+	service.URLs[0] = "http://modified.onion"
+
+	cached, err := ot.GetService("oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "OnionTree", cached.Name)
+	assert.Equal(t, []string{"http://onions53ehmf4q75.onion"}, cached.URLs)
+
+	// Updated service is not served from the cache.
+	if err := ot.UpdateService(service); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := ot.GetService("oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, service, updated)
+
+	// Neither is a service modified outside of the OnionTree.
+	time.Sleep(10 * time.Millisecond)
+	data := []byte("name: Outside\nurls:\n- http://outside.onion\n")
+	if err := ioutil.WriteFile(ot.UnsortedDir()+"/oniontree.yaml", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified, err := ot.GetService("oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Outside", modified.Name)
+
+	if err := ot.RemoveService("oniontree"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ot.GetService("oniontree")
+	assert.IsType(t, &oniontree.ErrIdNotExists{}, err)
+}
+
+func benchmarkGetService(b *testing.B, cache bool) {
+	ot, cleanup := copyOnionTree(b)
+	defer cleanup()
+
+	ids := []string{"oniontree"}
+	for i := 0; i < 1000; i++ {
+		service := oniontree.NewService(fmt.Sprintf("service-%d", i))
+		service.Name = "Service"
+		service.SetURLs([]string{"http://first.onion", "http://second.onion"})
+		if err := ot.AddService(service); err != nil {
+			b.Fatal(err)
+		}
+		ids = append(ids, service.ID())
+	}
+
+	if cache {
+		ot.EnableCache()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ot.GetService(ids[i%len(ids)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOnionTree_GetService(b *testing.B) {
+	benchmarkGetService(b, false)
+}
+
+func BenchmarkOnionTree_GetServiceCached(b *testing.B) {
+	benchmarkGetService(b, true)
+}
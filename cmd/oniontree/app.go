@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/go-yaml/yaml"
 	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/validator"
 	"github.com/urfave/cli/v2"
 	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
 )
 
 const Version = "0.1"
@@ -40,115 +46,130 @@ func (a *Application) handleInitCommand() cli.ActionFunc {
 	}
 }
 
-func (a *Application) handleAddCommand() cli.ActionFunc {
-	return func(c *cli.Context) error {
-		id := c.Args().First()
-		if id == "" {
-			return fmt.Errorf("Missing a service ID")
+func readPublicKeys(files []string) ([]*oniontree.PublicKey, error) {
+	publicKeys := make([]*oniontree.PublicKey, 0, len(files))
+	for i := range files {
+		b, err := ioutil.ReadFile(files[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key content: %s", err)
 		}
 
-		service := oniontree.NewService(id)
-		service.Name = c.String("name")
-		service.Description = c.String("description")
-		service.AddURLs(c.StringSlice("url"))
+		publicKey, err := oniontree.NewPublicKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process public key content: %s", err)
+		}
 
-		files := c.StringSlice("public-key")
-		publicKeys := make([]*oniontree.PublicKey, 0, len(files))
-		for i := range files {
-			b, err := ioutil.ReadFile(files[i])
-			if err != nil {
-				return fmt.Errorf("failed to read public key content: %s", err)
-			}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
 
-			publicKey, err := oniontree.NewPublicKey(b)
-			if err != nil {
-				return fmt.Errorf("failed to process public key content: %s", err)
-			}
+// tagService tags service `id` with `tags`. If `replace` is true,
+// the service is untagged from the tags it's currently tagged with.
+func (a *Application) tagService(id string, tags []oniontree.Tag, replace bool) error {
+	if replace {
+		oldTags, err := a.ot.ListServiceTags(id)
+		if err != nil {
+			return fmt.Errorf("failed to get old tags: %s", err)
+		}
 
-			publicKeys = append(publicKeys, publicKey)
+		if err := a.ot.UntagService(id, oldTags); err != nil {
+			return fmt.Errorf("failed to remove old tags: %s", err)
 		}
-		service.AddPublicKeys(publicKeys)
+	}
+	if err := a.ot.TagService(id, tags); err != nil {
+		return fmt.Errorf("failed to create new tags: %s", err)
+	}
+	return nil
+}
+
+func (a *Application) handleAddCommand() cli.ActionFunc {
+	addService := func(record *oniontree.Record) error {
+		service := oniontree.NewService(record.ID)
+		service.Name = record.Name
+		service.Description = record.Description
+		service.AddURLs(record.URLs)
+		service.AddPublicKeys(record.PublicKeys)
 
 		if err := a.ot.AddService(service); err != nil {
 			return fmt.Errorf("failed to add new service: %s", err)
 		}
-
+		if len(record.Tags) > 0 {
+			return a.tagService(record.ID, record.Tags, false)
+		}
 		return nil
 	}
-}
 
-func (a *Application) handleUpdateCommand() cli.ActionFunc {
-	readPublicKeyContent := func(pth string) (*oniontree.PublicKey, error) {
-		b, err := ioutil.ReadFile(pth)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read public key content: %s", err)
+	return func(c *cli.Context) error {
+		if c.Bool("stdin") {
+			return a.processStdin(c, func(item *stdinItem) error {
+				if !item.isRecord {
+					return fmt.Errorf("expected an NDJSON record")
+				}
+				return addService(item.record)
+			})
 		}
 
-		publicKey, err := oniontree.NewPublicKey(b)
+		id := c.Args().First()
+		if id == "" {
+			return fmt.Errorf("Missing a service ID")
+		}
+		if c.String("name") == "" || len(c.StringSlice("url")) == 0 {
+			return fmt.Errorf("Missing a service name or URL")
+		}
+
+		publicKeys, err := readPublicKeys(c.StringSlice("public-key"))
 		if err != nil {
-			return nil, fmt.Errorf("failed to process public key content: %s", err)
+			return err
 		}
 
-		return publicKey, nil
-	}
+		record := &oniontree.Record{ID: id}
+		record.Name = c.String("name")
+		record.Description = c.String("description")
+		record.URLs = c.StringSlice("url")
+		record.PublicKeys = publicKeys
 
-	return func(c *cli.Context) error {
-		id := c.Args().First()
-		if id == "" {
-			return cli.Exit("Missing a service ID", 1)
-		}
+		return addService(record)
+	}
+}
 
+func (a *Application) handleUpdateCommand() cli.ActionFunc {
+	// updateService applies non-empty fields of `patch` to service `id`.
+	updateService := func(id string, patch *oniontree.Record, replace bool) error {
 		service, err := a.ot.GetService(id)
 		if err != nil {
 			return fmt.Errorf("failed to read service content: %s", err)
 		}
 
 		changed := false
-		name := c.String("name")
-		description := c.String("description")
 
-		if name != "" && name != service.Name {
-			service.Name = name
+		if patch.Name != "" && patch.Name != service.Name {
+			service.Name = patch.Name
 			changed = true
 		}
-		if description != "" && description != service.Description {
-			service.Description = description
+		if patch.Description != "" && patch.Description != service.Description {
+			service.Description = patch.Description
 			changed = true
 		}
 
-		urls := c.StringSlice("url")
-
-		if len(urls) > 0 {
-			replace := c.Bool("replace")
+		if len(patch.URLs) > 0 {
 			addedURLs := 0
 			if replace {
-				addedURLs = service.SetURLs(urls)
+				addedURLs = service.SetURLs(patch.URLs)
 			} else {
-				addedURLs = service.AddURLs(urls)
+				addedURLs = service.AddURLs(patch.URLs)
 			}
 			if addedURLs > 0 {
 				changed = true
 			}
 		}
 
-		files := c.StringSlice("public-key")
-
-		if len(files) > 0 {
-			publicKeys := make([]*oniontree.PublicKey, 0, len(files))
-			for i := range files {
-				publicKey, err := readPublicKeyContent(files[i])
-				if err != nil {
-					return err
-				}
-				publicKeys = append(publicKeys, publicKey)
-			}
-
-			replace := c.Bool("replace")
+		if len(patch.PublicKeys) > 0 {
 			addedPublicKeys := 0
 			if replace {
-				addedPublicKeys = service.SetPublicKeys(publicKeys)
+				addedPublicKeys = service.SetPublicKeys(patch.PublicKeys)
 			} else {
-				addedPublicKeys = service.AddPublicKeys(publicKeys)
+				addedPublicKeys = service.AddPublicKeys(patch.PublicKeys)
 			}
 			if addedPublicKeys > 0 {
 				changed = true
@@ -161,12 +182,112 @@ func (a *Application) handleUpdateCommand() cli.ActionFunc {
 			}
 		}
 
+		if len(patch.Tags) > 0 {
+			return a.tagService(id, patch.Tags, replace)
+		}
+
+		return nil
+	}
+
+	return func(c *cli.Context) error {
+		publicKeys, err := readPublicKeys(c.StringSlice("public-key"))
+		if err != nil {
+			return err
+		}
+
+		patch := &oniontree.Record{}
+		patch.Name = c.String("name")
+		patch.Description = c.String("description")
+		patch.URLs = c.StringSlice("url")
+		patch.PublicKeys = publicKeys
+
+		replace := c.Bool("replace")
+
+		if c.Bool("stdin") {
+			// Plain IDs are updated using the values from the flags.
+			return a.processStdin(c, func(item *stdinItem) error {
+				if item.isRecord {
+					return updateService(item.record.ID, item.record, replace)
+				}
+				return updateService(item.record.ID, patch, replace)
+			})
+		}
+
+		id := c.Args().First()
+		if id == "" {
+			return cli.Exit("Missing a service ID", 1)
+		}
+
+		return updateService(id, patch, replace)
+	}
+}
+
+func (a *Application) handleEditCommand() cli.ActionFunc {
+	// diffTags returns tags from `a` that are not in `b`.
+	diffTags := func(a, b []oniontree.Tag) []oniontree.Tag {
+		diff := []oniontree.Tag{}
+	outer:
+		for i := range a {
+			for j := range b {
+				if a[i] == b[j] {
+					continue outer
+				}
+			}
+			diff = append(diff, a[i])
+		}
+		return diff
+	}
+
+	return func(c *cli.Context) error {
+		id := c.Args().First()
+		if id == "" {
+			return cli.Exit("Missing a service ID", 1)
+		}
+
+		content, err := a.ot.GetServiceBytes(id)
+		if err != nil {
+			return fmt.Errorf("failed to read service content: %s", err)
+		}
+		oldTags, err := a.ot.ListServiceTags(id)
+		if err != nil {
+			return fmt.Errorf("failed to get tags: %s", err)
+		}
+
+		service, newTags, err := editService(id, content, oldTags)
+		if err != nil {
+			if err == errEditCanceled {
+				fmt.Println(err)
+				return nil
+			}
+			return err
+		}
+
+		if err := a.ot.UpdateService(service); err != nil {
+			return fmt.Errorf("failed to update service: %s", err)
+		}
+		if tags := diffTags(oldTags, newTags); len(tags) > 0 {
+			if err := a.ot.UntagService(id, tags); err != nil {
+				return fmt.Errorf("failed to remove tags: %s", err)
+			}
+		}
+		if tags := diffTags(newTags, oldTags); len(tags) > 0 {
+			if err := a.ot.TagService(id, tags); err != nil {
+				return fmt.Errorf("failed to create new tags: %s", err)
+			}
+		}
+
 		return nil
 	}
 }
 
 func (a *Application) handleRemoveCommand() cli.ActionFunc {
 	return func(c *cli.Context) error {
+		if c.Bool("stdin") {
+			return a.processStdin(c, func(item *stdinItem) error {
+				return a.ot.RemoveService(item.record.ID)
+			})
+		}
+
 		ids := c.Args().Slice()
 
 		if len(ids) == 0 {
@@ -189,14 +310,20 @@ func (a *Application) handleRemoveCommand() cli.ActionFunc {
 	}
 }
 
+// stdinItemTags returns `tags` given by the flags, falling back to tags
+// from the NDJSON record.
+func stdinItemTags(item *stdinItem, tags []oniontree.Tag) ([]oniontree.Tag, error) {
+	if len(tags) == 0 && item.isRecord {
+		tags = item.record.Tags
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("missing tag names")
+	}
+	return tags, nil
+}
+
 func (a *Application) handleTagCommand() cli.ActionFunc {
 	return func(c *cli.Context) error {
-		ids := c.Args().Slice()
-
-		if len(ids) == 0 {
-			return fmt.Errorf("Missing service IDs")
-		}
-
 		replace := c.Bool("replace")
 
 		tags := make([]oniontree.Tag, len(c.StringSlice("name")))
@@ -204,19 +331,28 @@ func (a *Application) handleTagCommand() cli.ActionFunc {
 			tags[i] = oniontree.Tag(tag)
 		}
 
-		for i := range ids {
-			if replace {
-				oldTags, err := a.ot.ListServiceTags(ids[i])
+		if c.Bool("stdin") {
+			return a.processStdin(c, func(item *stdinItem) error {
+				tags, err := stdinItemTags(item, tags)
 				if err != nil {
-					return fmt.Errorf("failed to get old tags: %s", err)
+					return err
 				}
+				return a.tagService(item.record.ID, tags, replace)
+			})
+		}
 
-				if err := a.ot.UntagService(ids[i], oldTags); err != nil {
-					return fmt.Errorf("failed to remove old tags: %s", err)
-				}
-			}
-			if err := a.ot.TagService(ids[i], tags); err != nil {
-				return fmt.Errorf("failed to create new tags: %s", err)
+		ids := c.Args().Slice()
+
+		if len(ids) == 0 {
+			return fmt.Errorf("Missing service IDs")
+		}
+		if len(tags) == 0 {
+			return fmt.Errorf("Missing tag names")
+		}
+
+		for i := range ids {
+			if err := a.tagService(ids[i], tags, replace); err != nil {
+				return err
 			}
 		}
 
@@ -226,15 +362,31 @@ func (a *Application) handleTagCommand() cli.ActionFunc {
 
 func (a *Application) handleUntagCommand() cli.ActionFunc {
 	return func(c *cli.Context) error {
+		tags := make([]oniontree.Tag, len(c.StringSlice("name")))
+		for i, tag := range c.StringSlice("name") {
+			tags[i] = oniontree.Tag(tag)
+		}
+
+		if c.Bool("stdin") {
+			return a.processStdin(c, func(item *stdinItem) error {
+				tags, err := stdinItemTags(item, tags)
+				if err != nil {
+					return err
+				}
+				if err := a.ot.UntagService(item.record.ID, tags); err != nil {
+					return fmt.Errorf("failed to remove tags: %s", err)
+				}
+				return nil
+			})
+		}
+
 		ids := c.Args().Slice()
 
 		if len(ids) == 0 {
 			return fmt.Errorf("Missing service IDs")
 		}
-
-		tags := make([]oniontree.Tag, len(c.StringSlice("name")))
-		for i, tag := range c.StringSlice("name") {
-			tags[i] = oniontree.Tag(tag)
+		if len(tags) == 0 {
+			return fmt.Errorf("Missing tag names")
 		}
 
 		for i := range ids {
@@ -249,31 +401,39 @@ func (a *Application) handleUntagCommand() cli.ActionFunc {
 
 func (a *Application) handleLintCommand() cli.ActionFunc {
 	return func(c *cli.Context) error {
-		serviceIDs, err := a.ot.ListServices()
+		tmpl, err := outputTemplate(c)
 		if err != nil {
-			return fmt.Errorf("failed to list services: %s", err)
+			return err
 		}
-		tags, err := a.ot.ListTags()
+
+		issues, err := a.ot.Lint(c.Context)
 		if err != nil {
-			return fmt.Errorf("failed to list tags: %s", err)
+			return fmt.Errorf("failed to lint the repository: %s", err)
 		}
 
 		ok := true
-		for i := range serviceIDs {
-			service, err := a.ot.GetService(serviceIDs[i])
-			if err != nil {
-				return fmt.Errorf("failed to read service content: %s", err)
-			}
-
-			if err := service.Validate(); err != nil {
+		records := []interface{}{}
+		for _, issue := range issues {
+			if issue.Severity == validator.SeverityError {
 				ok = false
-				fmt.Printf("unsorted/%s: %s\n", service.ID(), err)
 			}
+			if tmpl != nil {
+				records = append(records, &lintRecord{
+					Path:     issue.Path,
+					Severity: issue.Severity.String(),
+					Error:    issue.Err.Error(),
+				})
+				continue
+			}
+			if issue.Severity == validator.SeverityError {
+				fmt.Printf("%s: %s\n", issue.Path, issue.Err)
+				continue
+			}
+			fmt.Printf("%s: %s: %s\n", issue.Path, issue.Severity, issue.Err)
 		}
-		for i := range tags {
-			if err := tags[i].Validate(); err != nil {
-				ok = false
-				fmt.Printf("tagged/%s: %s\n", tags[i], err)
+		if tmpl != nil {
+			if err := writeTemplate(os.Stdout, tmpl, records); err != nil {
+				return err
 			}
 		}
 
@@ -306,11 +466,28 @@ func (a *Application) handleShowCommand() cli.ActionFunc {
 			return cli.Exit("Missing a service ID", 1)
 		}
 
+		tmpl, err := outputTemplate(c)
+		if err != nil {
+			return err
+		}
+
 		service, err := a.ot.GetService(id)
 		if err != nil {
 			return fmt.Errorf("failed to read service content: %s", err)
 		}
 
+		if tmpl != nil {
+			tags, err := a.ot.ListServiceTags(id)
+			if err != nil {
+				return fmt.Errorf("failed to get tags: %s", err)
+			}
+			return writeTemplate(os.Stdout, tmpl, []interface{}{&oniontree.Record{
+				ID:      id,
+				Tags:    tags,
+				Service: *service,
+			}})
+		}
+
 		if c.Bool("json") {
 			printJSON(service)
 		} else {
@@ -321,6 +498,460 @@ func (a *Application) handleShowCommand() cli.ActionFunc {
 	}
 }
 
+func (a *Application) handleExportCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		tags := make([]oniontree.Tag, len(c.StringSlice("tag")))
+		for i, tag := range c.StringSlice("tag") {
+			tags[i] = oniontree.Tag(tag)
+		}
+
+		tmpl, err := outputTemplate(c)
+		if err != nil {
+			return err
+		}
+
+		w := os.Stdout
+		if filename := c.String("file"); filename != "" {
+			file, err := os.Create(filename)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %s", err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if tmpl != nil {
+			// Records are exported as NDJSON first, so that the selection
+			// of services is the same as without the template.
+			buf := &bytes.Buffer{}
+			if err := a.ot.Export(buf, oniontree.FormatNDJSON, tags...); err != nil {
+				return fmt.Errorf("failed to export services: %s", err)
+			}
+			records := []interface{}{}
+			decoder := json.NewDecoder(buf)
+			for decoder.More() {
+				record := &oniontree.Record{}
+				if err := decoder.Decode(record); err != nil {
+					return fmt.Errorf("failed to export services: %s", err)
+				}
+				records = append(records, record)
+			}
+			return writeTemplate(w, tmpl, records)
+		}
+
+		if err := a.ot.Export(w, oniontree.Format(c.String("output")), tags...); err != nil {
+			return fmt.Errorf("failed to export services: %s", err)
+		}
+
+		return nil
+	}
+}
+
+func (a *Application) handleImportCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		tags := make([]oniontree.Tag, len(c.StringSlice("tag")))
+		for i, tag := range c.StringSlice("tag") {
+			tags[i] = oniontree.Tag(tag)
+		}
+
+		r := os.Stdin
+		if input := c.Args().First(); input != "" && input != "-" {
+			file, err := os.Open(input)
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %s", err)
+			}
+			defer file.Close()
+			r = file
+		}
+
+		results, err := a.ot.Import(r, oniontree.ImportOptions{
+			Format:   oniontree.Format(c.String("input-format")),
+			Strategy: oniontree.ImportStrategy(c.String("strategy")),
+			Tags:     tags,
+			DryRun:   c.Bool("dry-run"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import services: %s", err)
+		}
+
+		ok := true
+		for _, result := range results {
+			if result.Err != nil {
+				ok = false
+				fmt.Printf("%d: %s: %s\n", result.Index, result.ID, result.Err)
+				continue
+			}
+			fmt.Printf("%d: %s: %s\n", result.Index, result.ID, result.Action)
+		}
+
+		if !ok {
+			return cli.Exit("", 1)
+		}
+
+		return nil
+	}
+}
+
+func (a *Application) handleListCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		output, err := outputFormat(c)
+		if err != nil {
+			return err
+		}
+		tmpl, err := outputTemplate(c)
+		if err != nil {
+			return err
+		}
+
+		// Tags are always available in templates.
+		withTags := c.Bool("with-tags") || tmpl != nil
+		tagsByService := map[string][]oniontree.Tag{}
+		if withTags {
+			tagsByService, err = a.ot.ListTagsByService()
+			if err != nil {
+				return fmt.Errorf("failed to list tags: %s", err)
+			}
+		}
+
+		var filter func(id string) bool
+		if tags := c.StringSlice("tag"); len(tags) > 0 {
+			selected := map[string]struct{}{}
+			for i := range tags {
+				var serviceIDs []string
+				if c.Bool("recursive") {
+					serviceIDs, err = a.ot.ListServicesWithTagRecursive(oniontree.Tag(tags[i]))
+				} else {
+					serviceIDs, err = a.ot.ListServicesWithTag(oniontree.Tag(tags[i]))
+				}
+				if err != nil {
+					return fmt.Errorf("failed to list services: %s", err)
+				}
+				for _, id := range serviceIDs {
+					selected[id] = struct{}{}
+				}
+			}
+			filter = func(id string) bool {
+				_, ok := selected[id]
+				return ok
+			}
+		}
+
+		it := a.ot.IterateServices(c.Context, oniontree.IterateOptions{
+			Sorted: true,
+			Filter: filter,
+		})
+		defer it.Close()
+
+		records := []interface{}{}
+		for it.Next() {
+			id, service, err := it.Service()
+			if err != nil {
+				return fmt.Errorf("failed to read service content: %s", err)
+			}
+			record := &oniontree.Record{
+				ID:      id,
+				Service: *service,
+			}
+			if withTags {
+				record.Tags = tagsByService[id]
+			}
+			records = append(records, record)
+		}
+		if err := it.Err(); err != nil {
+			return fmt.Errorf("failed to list services: %s", err)
+		}
+
+		if tmpl != nil {
+			return writeTemplate(os.Stdout, tmpl, records)
+		}
+
+		switch output {
+		case outputJSON, outputNDJSON:
+			return writeJSON(os.Stdout, output, records)
+		case outputPlain:
+			for i := range records {
+				record := records[i].(*oniontree.Record)
+				fields := []string{record.ID}
+				for _, tag := range record.Tags {
+					fields = append(fields, tag.String())
+				}
+				fmt.Println(strings.Join(fields, " "))
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if withTags {
+			fmt.Fprintf(w, "ID\tNAME\tURLS\tTAGS\n")
+		} else {
+			fmt.Fprintf(w, "ID\tNAME\tURLS\n")
+		}
+		for i := range records {
+			record := records[i].(*oniontree.Record)
+			fmt.Fprintf(w, "%s\t%s\t%d", record.ID, record.Name, len(record.URLs))
+			if withTags {
+				tags := make([]string, len(record.Tags))
+				for j := range record.Tags {
+					tags[j] = record.Tags[j].String()
+				}
+				fmt.Fprintf(w, "\t%s", strings.Join(tags, ", "))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+		return w.Flush()
+	}
+}
+
+func (a *Application) handleTagsCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		output, err := outputFormat(c)
+		if err != nil {
+			return err
+		}
+		tmpl, err := outputTemplate(c)
+		if err != nil {
+			return err
+		}
+
+		tags, err := a.ot.ListTags()
+		if err != nil {
+			return fmt.Errorf("failed to list tags: %s", err)
+		}
+
+		records := make([]interface{}, 0, len(tags))
+		for i := range tags {
+			serviceIDs, err := a.ot.ListServicesWithTag(tags[i])
+			if err != nil {
+				return fmt.Errorf("failed to list services: %s", err)
+			}
+			metadata, err := a.ot.GetTagMetadata(tags[i])
+			if err != nil {
+				if _, ok := err.(*oniontree.ErrTagMetadataNotExists); !ok {
+					return fmt.Errorf("failed to read tag metadata: %s", err)
+				}
+				metadata = &oniontree.TagMetadata{}
+			}
+			records = append(records, &tagRecord{
+				Tag:         tags[i],
+				Services:    len(serviceIDs),
+				TagMetadata: metadata,
+			})
+		}
+
+		if tmpl != nil {
+			return writeTemplate(os.Stdout, tmpl, records)
+		}
+
+		switch output {
+		case outputJSON, outputNDJSON:
+			return writeJSON(os.Stdout, output, records)
+		case outputPlain:
+			for i := range tags {
+				fmt.Println(tags[i])
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "TAG\tSERVICES\tDESCRIPTION\n")
+		for i := range records {
+			record := records[i].(*tagRecord)
+			fmt.Fprintf(w, "%s\t%d\t%s\n", record.Tag, record.Services, record.Description)
+		}
+		return w.Flush()
+	}
+}
+
+func (a *Application) handleTagsRenameCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return cli.Exit("Expected an old and a new tag name", 1)
+		}
+		oldTag := oniontree.Tag(c.Args().Get(0))
+		newTag := oniontree.Tag(c.Args().Get(1))
+
+		if err := a.ot.RenameTag(oldTag, newTag); err != nil {
+			return fmt.Errorf("failed to rename tag: %s", err)
+		}
+		return nil
+	}
+}
+
+func (a *Application) handleTagsDeleteCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		tag := oniontree.Tag(c.Args().First())
+		if tag == "" {
+			return cli.Exit("Missing a tag name", 1)
+		}
+
+		if err := a.ot.DeleteTag(tag); err != nil {
+			return fmt.Errorf("failed to delete tag: %s", err)
+		}
+		return nil
+	}
+}
+
+func (a *Application) handleTagInfoCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		tag := oniontree.Tag(c.Args().First())
+		if tag == "" {
+			return cli.Exit("Missing a tag name", 1)
+		}
+
+		tmpl, err := outputTemplate(c)
+		if err != nil {
+			return err
+		}
+
+		serviceIDs, err := a.ot.ListServicesWithTag(tag)
+		if err != nil {
+			if _, ok := err.(*oniontree.ErrTagNotExists); !ok {
+				return fmt.Errorf("failed to list services: %s", err)
+			}
+		}
+		metadata, err := a.ot.GetTagMetadata(tag)
+		if err != nil {
+			if _, ok := err.(*oniontree.ErrTagMetadataNotExists); !ok {
+				return fmt.Errorf("failed to read tag metadata: %s", err)
+			}
+			if serviceIDs == nil {
+				return fmt.Errorf("tag with name `%s` does not exist", tag)
+			}
+			metadata = &oniontree.TagMetadata{}
+		}
+
+		if tmpl != nil {
+			return writeTemplate(os.Stdout, tmpl, []interface{}{&tagRecord{
+				Tag:         tag,
+				Services:    len(serviceIDs),
+				TagMetadata: metadata,
+			}})
+		}
+
+		aliases := make([]string, len(metadata.Aliases))
+		for i := range metadata.Aliases {
+			aliases[i] = metadata.Aliases[i].String()
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		fmt.Fprintf(w, "Tag:\t%s\n", tag)
+		fmt.Fprintf(w, "Display name:\t%s\n", metadata.DisplayName)
+		fmt.Fprintf(w, "Description:\t%s\n", metadata.Description)
+		fmt.Fprintf(w, "Aliases:\t%s\n", strings.Join(aliases, ", "))
+		fmt.Fprintf(w, "Parent:\t%s\n", metadata.Parent)
+		fmt.Fprintf(w, "Services:\t%d\n", len(serviceIDs))
+		return w.Flush()
+	}
+}
+
+func (a *Application) handleScanCommand() cli.ActionFunc {
+	return func(c *cli.Context) error {
+		output, err := outputFormat(c)
+		if err != nil {
+			return err
+		}
+		tmpl, err := outputTemplate(c)
+		if err != nil {
+			return err
+		}
+
+		cfg := scanner.DefaultScannerConfig
+		cfg.ProxyAddress = c.String("proxy")
+		cfg.WorkerTCPConnectionsMax = c.Int64("connections")
+		cfg.WorkerTCPConnectionsPerHostMax = c.Int64("connections-per-host")
+		cfg.WorkerConfig.PingTimeout = c.Duration("timeout")
+		cfg.WorkerConfig.PingRetryAttempts = c.Int("retry-attempts")
+		cfg.WorkerConfig.PingRetryInterval = c.Duration("retry-interval")
+		// Keep the default backoff, which has jitter, unless a name is given.
+		if c.IsSet("retry-backoff") {
+			cfg.WorkerConfig.RetryBackoff, err = scanner.ParseBackoff(c.String("retry-backoff"))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Unsupported backoff `%s`", c.String("retry-backoff")), 1)
+			}
+		}
+		cfg.WorkerConfig.Probe = scanner.ProbeConfig{
+			Type: scanner.ProbeType(c.String("probe")),
+			Path: c.String("path"),
+		}
+		if cfg.WorkerTCPConnectionsMax < 1 {
+			return cli.Exit("Flag --connections must be at least 1", 1)
+		}
+
+		var selected map[string]struct{}
+		selectServices := func(serviceIDs []string) {
+			if selected == nil {
+				selected = map[string]struct{}{}
+			}
+			for _, id := range serviceIDs {
+				selected[id] = struct{}{}
+			}
+		}
+		if c.NArg() > 0 {
+			for _, id := range c.Args().Slice() {
+				if _, err := a.ot.GetService(id); err != nil {
+					return fmt.Errorf("failed to read service content: %s", err)
+				}
+			}
+			selectServices(c.Args().Slice())
+		}
+		for _, tag := range c.StringSlice("tag") {
+			serviceIDs, err := a.ot.ListServicesWithTag(oniontree.Tag(tag))
+			if err != nil {
+				return fmt.Errorf("failed to list services: %s", err)
+			}
+			selectServices(serviceIDs)
+		}
+		var filter func(serviceID string) bool
+		if selected != nil {
+			filter = func(serviceID string) bool {
+				_, ok := selected[serviceID]
+				return ok
+			}
+		}
+
+		report, err := scanner.NewScanner(cfg).ScanOnce(c.Context, a.ot.Dir(), filter)
+		if err != nil {
+			return fmt.Errorf("failed to scan services: %s", err)
+		}
+
+		records := make([]interface{}, len(report.Results))
+		for i := range report.Results {
+			records[i] = newScanRecord(report.Results[i])
+		}
+
+		if tmpl != nil {
+			err = writeTemplate(os.Stdout, tmpl, records)
+		} else {
+			switch output {
+			case outputJSON, outputNDJSON:
+				err = writeJSON(os.Stdout, output, records)
+			case outputPlain:
+				for i := range records {
+					record := records[i].(*scanRecord)
+					fmt.Printf("%s %s\n", record.URL, record.Status)
+				}
+			default:
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintf(w, "ID\tURL\tSTATUS\tATTEMPTS\tCONNECT\tERROR\n")
+				for i := range records {
+					record := records[i].(*scanRecord)
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.3fs\t%s\n", record.ServiceID, record.URL, record.Status,
+						record.Attempts, record.ConnectTime, record.Error)
+				}
+				err = w.Flush()
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if c.Bool("fail-offline") && len(report.Offline()) > 0 {
+			return cli.Exit("", 1)
+		}
+		return nil
+	}
+}
+
 func (a *Application) Run(args []string) error {
 	return a.app.Run(args)
 }
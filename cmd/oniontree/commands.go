@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/oniontree-org/go-oniontree/scanner"
 	"github.com/urfave/cli/v2"
 )
 
@@ -25,23 +26,25 @@ func (a *Application) commands() {
 				Action:    a.handleAddCommand(),
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "name",
-						Usage:    "service name",
-						Required: true,
+						Name:  "name",
+						Usage: "service name",
 					},
 					&cli.StringFlag{
 						Name:  "description",
 						Usage: "service description (supports Markdown)",
 					},
 					&cli.StringSliceFlag{
-						Name:     "url",
-						Usage:    "service URL",
-						Required: true,
+						Name:  "url",
+						Usage: "service URL",
 					},
 					&cli.StringSliceFlag{
 						Name:  "public-key",
 						Usage: "path to file with PGP public key",
 					},
+					&cli.BoolFlag{
+						Name:  "stdin",
+						Usage: "read service IDs or NDJSON records from standard input",
+					},
 				},
 			},
 			&cli.Command{
@@ -71,8 +74,19 @@ func (a *Application) commands() {
 						Name:  "replace",
 						Usage: "replace compound values",
 					},
+					&cli.BoolFlag{
+						Name:  "stdin",
+						Usage: "read service IDs or NDJSON records from standard input",
+					},
 				},
 			},
+			&cli.Command{
+				Name:      "edit",
+				Usage:     "Edit a service in $EDITOR",
+				ArgsUsage: "<id>",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleEditCommand(),
+			},
 			&cli.Command{
 				Name:      "show",
 				Usage:     "Show service's content",
@@ -84,6 +98,10 @@ func (a *Application) commands() {
 						Name:  "json",
 						Usage: "switch output to json",
 					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
+					},
 				},
 			},
 			&cli.Command{
@@ -92,6 +110,12 @@ func (a *Application) commands() {
 				ArgsUsage: "<id>[ id...]",
 				Before:    a.handleOnionTreeOpen(),
 				Action:    a.handleRemoveCommand(),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "stdin",
+						Usage: "read service IDs or NDJSON records from standard input",
+					},
+				},
 			},
 			&cli.Command{
 				Name:      "tag",
@@ -101,14 +125,17 @@ func (a *Application) commands() {
 				Action:    a.handleTagCommand(),
 				Flags: []cli.Flag{
 					&cli.StringSliceFlag{
-						Name:     "name",
-						Usage:    "tag name",
-						Required: true,
+						Name:  "name",
+						Usage: "tag name",
 					},
 					&cli.BoolFlag{
 						Name:  "replace",
 						Usage: "replace tags",
 					},
+					&cli.BoolFlag{
+						Name:  "stdin",
+						Usage: "read service IDs or NDJSON records from standard input",
+					},
 				},
 			},
 			&cli.Command{
@@ -119,9 +146,89 @@ func (a *Application) commands() {
 				Action:    a.handleUntagCommand(),
 				Flags: []cli.Flag{
 					&cli.StringSliceFlag{
-						Name:     "name",
-						Usage:    "tag name",
-						Required: true,
+						Name:  "name",
+						Usage: "tag name",
+					},
+					&cli.BoolFlag{
+						Name:  "stdin",
+						Usage: "read service IDs or NDJSON records from standard input",
+					},
+				},
+			},
+			&cli.Command{
+				Name:      "list",
+				Usage:     "List services",
+				ArgsUsage: " ",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleListCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "output format (table, plain, json, ndjson)",
+						Value: "table",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "list only services tagged with the tag",
+					},
+					&cli.BoolFlag{
+						Name:  "recursive",
+						Usage: "include services tagged with nested tags",
+					},
+					&cli.BoolFlag{
+						Name:  "with-tags",
+						Usage: "include tags of each service",
+					},
+				},
+			},
+			&cli.Command{
+				Name:      "tags",
+				Usage:     "List tags",
+				ArgsUsage: " ",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleTagsCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "output format (table, plain, json, ndjson)",
+						Value: "table",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
+					},
+				},
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:      "rename",
+						Usage:     "Rename tag across all services",
+						ArgsUsage: "<old> <new>",
+						Before:    a.handleOnionTreeOpen(),
+						Action:    a.handleTagsRenameCommand(),
+					},
+					&cli.Command{
+						Name:      "delete",
+						Usage:     "Delete tag from all services",
+						ArgsUsage: "<tag>",
+						Before:    a.handleOnionTreeOpen(),
+						Action:    a.handleTagsDeleteCommand(),
+					},
+				},
+			},
+			&cli.Command{
+				Name:      "tag-info",
+				Usage:     "Show tag's metadata",
+				ArgsUsage: "<tag>",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleTagInfoCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
 					},
 				},
 			},
@@ -131,6 +238,135 @@ func (a *Application) commands() {
 				ArgsUsage: " ",
 				Before:    a.handleOnionTreeOpen(),
 				Action:    a.handleLintCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
+					},
+				},
+			},
+			&cli.Command{
+				Name:      "export",
+				Usage:     "Export services to a single file",
+				ArgsUsage: " ",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleExportCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "json",
+						Usage: "output format (json, ndjson, yaml)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "export only services with tag",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "write output to file instead of stdout",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
+					},
+				},
+			},
+			&cli.Command{
+				Name:      "import",
+				Usage:     "Import services from a file",
+				ArgsUsage: "[file]",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleImportCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "input-format",
+						Value: "ndjson",
+						Usage: "input format (json, ndjson, yaml, csv, text)",
+					},
+					&cli.StringFlag{
+						Name:  "strategy",
+						Value: "skip",
+						Usage: "how to handle existing services (skip, merge, overwrite)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "tag imported services",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "validate records without changing the repository",
+					},
+				},
+			},
+			&cli.Command{
+				Name:      "scan",
+				Usage:     "Check once whether services are online",
+				ArgsUsage: "[id...]",
+				Before:    a.handleOnionTreeOpen(),
+				Action:    a.handleScanCommand(),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "output format (table, plain, json, ndjson)",
+						Value: "table",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format output using a Go template",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "scan only services tagged with the tag",
+					},
+					&cli.StringFlag{
+						Name:  "proxy",
+						Usage: "address of a SOCKS5 proxy",
+						Value: "127.0.0.1:9050",
+					},
+					&cli.Int64Flag{
+						Name:  "connections",
+						Usage: "maximum number of parallel connections",
+						Value: scanner.DefaultScannerConfig.WorkerTCPConnectionsMax,
+					},
+					&cli.Int64Flag{
+						Name:  "connections-per-host",
+						Usage: "maximum number of parallel connections to a single host (0 for no limit)",
+						Value: scanner.DefaultScannerConfig.WorkerTCPConnectionsPerHostMax,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "timeout of a single attempt",
+						Value: scanner.DefaultWorkerConfig.PingTimeout,
+					},
+					&cli.IntFlag{
+						Name:  "retry-attempts",
+						Usage: "number of attempts before a URL is reported offline",
+						Value: scanner.DefaultWorkerConfig.PingRetryAttempts,
+					},
+					&cli.DurationFlag{
+						Name:  "retry-interval",
+						Usage: "base interval between attempts",
+						Value: scanner.DefaultWorkerConfig.PingRetryInterval,
+					},
+					&cli.StringFlag{
+						Name:  "retry-backoff",
+						Usage: "backoff between attempts (fixed, exponential, decorrelated) (default: exponential with jitter)",
+					},
+					&cli.StringFlag{
+						Name:  "probe",
+						Usage: "probe type (tcp, http)",
+						Value: string(scanner.ProbeTCP),
+					},
+					&cli.StringFlag{
+						Name:  "path",
+						Usage: "path requested by the http probe",
+					},
+					&cli.BoolFlag{
+						Name:  "fail-offline",
+						Usage: "exit with status 1 if any URL is offline",
+					},
+				},
 			},
 		},
 		HideHelpCommand: true,
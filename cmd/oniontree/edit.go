@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"github.com/oniontree-org/go-oniontree"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// editTagsHeader matches the header line with service's tags in the edit buffer.
+var editTagsHeader = regexp.MustCompile(`^#\s*tags:(.*)$`)
+
+// editHelp is a header of the edit buffer.
+const editHelp = "# Editing service `%s`. Lines beginning with '#' are ignored,\n" +
+	"# except for the list of tags below. An empty file aborts the edit.\n"
+
+// errEditCanceled is returned if the edit buffer is left empty or unchanged.
+var errEditCanceled = errors.New("edit canceled, no changes made")
+
+// encodeEditBuffer returns content presented to the user in the editor.
+// Errors from the previous attempt are listed at the top of the buffer.
+func encodeEditBuffer(id string, content []byte, tags []oniontree.Tag, errs []string) []byte {
+	buf := &bytes.Buffer{}
+	for _, err := range errs {
+		fmt.Fprintf(buf, "# error: %s\n", err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(buf, "#\n")
+	}
+	fmt.Fprintf(buf, editHelp, id)
+	tagNames := make([]string, len(tags))
+	for i := range tags {
+		tagNames[i] = tags[i].String()
+	}
+	fmt.Fprintf(buf, "# tags: %s\n", strings.Join(tagNames, ", "))
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+// decodeEditBuffer parses content of the edit buffer, returning the service
+// and its tags. Lines produced by encodeEditBuffer are stripped off
+// and the remaining content is returned as `stripped`.
+func decodeEditBuffer(id string, b []byte) (service *oniontree.Service, tags []oniontree.Tag, stripped []byte, err error) {
+	header := map[string]struct{}{"#": {}}
+	for _, line := range strings.Split(fmt.Sprintf(editHelp, id), "\n") {
+		header[line] = struct{}{}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		line = strings.TrimSuffix(line, "\n")
+		if _, ok := header[line]; ok || strings.HasPrefix(line, "# error:") {
+			continue
+		}
+		if m := editTagsHeader.FindStringSubmatch(line); m != nil {
+			for _, tag := range strings.FieldsFunc(m[1], func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			}) {
+				tags = append(tags, oniontree.Tag(tag))
+			}
+			continue
+		}
+		buf.WriteString(line + "\n")
+	}
+	stripped = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+
+	service = oniontree.NewService(id)
+	if err := yaml.Unmarshal(stripped, service); err != nil {
+		return nil, nil, stripped, err
+	}
+	return service, tags, stripped, nil
+}
+
+// runEditor opens file `pth` in the editor set by environment variable EDITOR.
+func runEditor(pth string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], pth)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// isBlank returns true if `b` contains only comments and whitespace.
+func isBlank(b []byte) bool {
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// validateNewTags validates tags from `tags` that are not in `oldTags`.
+// Existing tags are left alone, so that the edit isn't blocked by them.
+func validateNewTags(tags, oldTags []oniontree.Tag) error {
+	existing := map[oniontree.Tag]struct{}{}
+	for i := range oldTags {
+		existing[oldTags[i]] = struct{}{}
+	}
+	for i := range tags {
+		if _, ok := existing[tags[i]]; ok {
+			continue
+		}
+		if err := tags[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editService lets the user edit `content` of service `id` along with its `tags`
+// until the result is valid. It returns errEditCanceled if the user
+// leaves the buffer empty, or doesn't change it.
+func editService(id string, content []byte, tags []oniontree.Tag) (*oniontree.Service, []oniontree.Tag, error) {
+	file, err := ioutil.TempFile("", "oniontree-edit-*.yaml")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(file.Name())
+	if err := file.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	buf := encodeEditBuffer(id, content, tags, nil)
+	for {
+		if err := ioutil.WriteFile(file.Name(), buf, 0600); err != nil {
+			return nil, nil, err
+		}
+		if err := runEditor(file.Name()); err != nil {
+			return nil, nil, fmt.Errorf("editor failed: %s", err)
+		}
+		edited, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			return nil, nil, err
+		}
+		if isBlank(edited) || bytes.Equal(edited, buf) {
+			return nil, nil, errEditCanceled
+		}
+
+		service, newTags, stripped, err := decodeEditBuffer(id, edited)
+		if err == nil {
+			err = service.Validate()
+		}
+		if err == nil {
+			err = validateNewTags(newTags, tags)
+		}
+		if err == nil {
+			return service, newTags, nil
+		}
+
+		buf = encodeEditBuffer(id, stripped, newTags, strings.Split(err.Error(), "\n"))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/urfave/cli/v2"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// Output formats of the commands listing services or tags.
+const (
+	outputTable  = "table"
+	outputPlain  = "plain"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// tagRecord is a tag with its metadata as written by `tags` and `tag-info`.
+// Field TagMetadata is never nil, so that templates can access its fields.
+type tagRecord struct {
+	Tag      oniontree.Tag `json:"tag"`
+	Services int           `json:"services"`
+	*oniontree.TagMetadata
+}
+
+// lintRecord is an issue found by `lint` as given to templates.
+type lintRecord struct {
+	Path     string `json:"path"`
+	Severity string `json:"severity"`
+	Error    string `json:"error"`
+}
+
+// scanRecord is a result of scanning a URL as written by `scan`.
+// Times are in seconds.
+type scanRecord struct {
+	ServiceID   string  `json:"service_id"`
+	URL         string  `json:"url"`
+	Status      string  `json:"status"`
+	Attempts    int     `json:"attempts"`
+	ConnectTime float64 `json:"connect_time"`
+	TTFB        float64 `json:"ttfb,omitempty"`
+	StatusCode  int     `json:"status_code,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+func newScanRecord(event scanner.ScanEvent) *scanRecord {
+	record := &scanRecord{
+		ServiceID:   event.ServiceID,
+		URL:         event.URL,
+		Status:      event.Status.String(),
+		Attempts:    event.Attempts,
+		ConnectTime: event.ConnectTime.Seconds(),
+		TTFB:        event.TTFB.Seconds(),
+	}
+	if event.Probe != nil {
+		record.StatusCode = event.Probe.StatusCode
+		record.Title = event.Probe.Title
+	}
+	if event.Error != nil {
+		record.Error = event.Error.Error()
+	}
+	return record
+}
+
+// outputFormat returns the value of flag `output`, or an error if the format is not supported.
+func outputFormat(c *cli.Context) (string, error) {
+	output := c.String("output")
+	switch output {
+	case outputTable, outputPlain, outputJSON, outputNDJSON:
+		return output, nil
+	}
+	return "", cli.Exit(fmt.Sprintf("Unsupported output format `%s`", output), 1)
+}
+
+// writeJSON writes `items` to `w` as a JSON array, or one item per line
+// if `output` is outputNDJSON.
+func writeJSON(w io.Writer, output string, items []interface{}) error {
+	encoder := json.NewEncoder(w)
+	if output == outputNDJSON {
+		for i := range items {
+			if err := encoder.Encode(items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return encoder.Encode(items)
+}
+
+// templateFuncs are functions available in templates given by flag `format`.
+var templateFuncs = template.FuncMap{
+	"join": func(values interface{}, sep string) (string, error) {
+		switch v := values.(type) {
+		case []string:
+			return strings.Join(v, sep), nil
+		case []oniontree.Tag:
+			s := make([]string, len(v))
+			for i := range v {
+				s[i] = v[i].String()
+			}
+			return strings.Join(s, sep), nil
+		}
+		return "", fmt.Errorf("cannot join values of type %T", values)
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// outputTemplate returns a template given by flag `format`, or nil if the flag is not set.
+func outputTemplate(c *cli.Context) (*template.Template, error) {
+	text := c.String("format")
+	if text == "" {
+		return nil, nil
+	}
+	if c.IsSet("output") || c.IsSet("json") {
+		return nil, cli.Exit("Flag --format cannot be combined with other output flags", 1)
+	}
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Invalid template: %s", err), 1)
+	}
+	return tmpl, nil
+}
+
+// writeTemplate executes `tmpl` for each of `items`, each followed by a newline.
+func writeTemplate(w io.Writer, tmpl *template.Template, items []interface{}) error {
+	for i := range items {
+		if err := tmpl.Execute(w, items[i]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/urfave/cli/v2"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdinBatchSize is a number of items processed before the report is flushed.
+const stdinBatchSize = 100
+
+// stdinItem is a single line read from the standard input. The line is either
+// a plain service ID, or an NDJSON record in the format written by `export`.
+type stdinItem struct {
+	line   int
+	record *oniontree.Record
+	// isRecord is true if the line is an NDJSON record, not just an ID.
+	isRecord bool
+	err      error
+}
+
+// stdinReport is a result of processing a single item.
+type stdinReport struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// readStdinItems reads items from `r` and passes them to `fn` in batches
+// of size `batchSize`. Items that cannot be parsed have field err set.
+func readStdinItems(r io.Reader, batchSize int, fn func(batch []*stdinItem) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	batch := make([]*stdinItem, 0, batchSize)
+	for idx := 1; scanner.Scan(); idx++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		item := &stdinItem{
+			line:   idx,
+			record: &oniontree.Record{},
+		}
+		if strings.HasPrefix(line, "{") {
+			item.isRecord = true
+			item.err = json.Unmarshal([]byte(line), item.record)
+		} else {
+			item.record.ID = line
+		}
+		if item.err == nil && item.record.ID == "" {
+			item.err = errors.New("missing service ID")
+		}
+
+		batch = append(batch, item)
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// processStdin calls `process` for every item read from the standard input
+// and writes a report for each of them to the standard output as NDJSON.
+// If processing of any item fails, the command exits with status 1.
+func (a *Application) processStdin(c *cli.Context, process func(item *stdinItem) error) error {
+	if c.Args().Present() {
+		return cli.Exit("Service IDs cannot be combined with --stdin", 1)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	encoder := json.NewEncoder(w)
+	failed := 0
+
+	err := readStdinItems(os.Stdin, stdinBatchSize, func(batch []*stdinItem) error {
+		for _, item := range batch {
+			err := item.err
+			if err == nil {
+				err = process(item)
+			}
+			report := stdinReport{
+				Line: item.line,
+				ID:   item.record.ID,
+				OK:   err == nil,
+			}
+			if err != nil {
+				report.Error = err.Error()
+				failed++
+			}
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to process standard input: %s", err)
+	}
+
+	if failed > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
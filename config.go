@@ -0,0 +1,56 @@
+package oniontree
+
+import (
+	"github.com/go-yaml/yaml"
+	"io/ioutil"
+	"path"
+	"time"
+)
+
+// Config is a repository configuration stored in file `.oniontree`.
+// The file may be empty, in which case defaults are used.
+type Config struct {
+	Lint    LintConfig    `yaml:"lint,omitempty"`
+	Scanner ScannerConfig `yaml:"scanner,omitempty"`
+}
+
+type LintConfig struct {
+	// Rules maps names of validation rules to severities
+	// "off", "warning" or "error".
+	Rules map[string]string `yaml:"rules,omitempty"`
+}
+
+type ScannerConfig struct {
+	// Policies set how often services are scanned. The first policy
+	// matching a service applies.
+	Policies []ScanPolicy `yaml:"policies,omitempty"`
+}
+
+// ScanPolicy sets ping intervals of services with IDs `Services`, or tagged
+// with any of `Tags` or their descendants. Zero values are left to the scanner.
+type ScanPolicy struct {
+	Services          []string      `yaml:"services,omitempty"`
+	Tags              []Tag         `yaml:"tags,omitempty"`
+	PingInterval      time.Duration `yaml:"ping_interval,omitempty"`
+	PingTimeout       time.Duration `yaml:"ping_timeout,omitempty"`
+	PingPauseInterval time.Duration `yaml:"ping_pause_interval,omitempty"`
+	PingRetryInterval time.Duration `yaml:"ping_retry_interval,omitempty"`
+	PingRetryAttempts int           `yaml:"ping_retry_attempts,omitempty"`
+	// RetryBackoff is one of "fixed", "exponential" or "decorrelated".
+	RetryBackoff string        `yaml:"retry_backoff,omitempty"`
+	Jitter       float64       `yaml:"jitter,omitempty"`
+	StartJitter  time.Duration `yaml:"start_jitter,omitempty"`
+}
+
+// Config returns the repository configuration.
+func (o OnionTree) Config() (*Config, error) {
+	b, err := ioutil.ReadFile(path.Join(o.dir, cairnName))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
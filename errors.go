@@ -34,6 +34,14 @@ func (e *ErrTagNotExists) Error() string {
 	return fmt.Sprintf("tag with name `%s` does not exist", e.tag)
 }
 
+type ErrTagExists struct {
+	tag Tag
+}
+
+func (e *ErrTagExists) Error() string {
+	return fmt.Sprintf("tag with name `%s` already exists", e.tag)
+}
+
 type ErrInvalidID struct {
 	id      string
 	pattern string
@@ -51,3 +59,27 @@ type ErrInvalidTagName struct {
 func (e *ErrInvalidTagName) Error() string {
 	return fmt.Sprintf("tag name `%s` does not match the pattern \"%s\"", e.name, e.pattern)
 }
+
+type ErrUnsupportedFormat struct {
+	format string
+}
+
+func (e *ErrUnsupportedFormat) Error() string {
+	return fmt.Sprintf("format `%s` is not supported", e.format)
+}
+
+type ErrTagMetadataNotExists struct {
+	tag Tag
+}
+
+func (e *ErrTagMetadataNotExists) Error() string {
+	return fmt.Sprintf("metadata of tag `%s` do not exist", e.tag)
+}
+
+type ErrTagParentCycle struct {
+	tag Tag
+}
+
+func (e *ErrTagParentCycle) Error() string {
+	return fmt.Sprintf("tag `%s` cannot be its own ancestor", e.tag)
+}
@@ -0,0 +1,126 @@
+package oniontree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"io"
+)
+
+type Format string
+
+const (
+	FormatJSON   Format = "json"
+	FormatNDJSON Format = "ndjson"
+	FormatYAML   Format = "yaml"
+)
+
+// Record is a service with its ID and tags embedded.
+type Record struct {
+	ID      string `json:"id" yaml:"id"`
+	Tags    []Tag  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Service `yaml:",inline"`
+}
+
+// Export writes all services in the repository to `w` encoded in `format`.
+// If `tags` are specified, only services tagged with at least one of them are exported.
+func (o OnionTree) Export(w io.Writer, format Format, tags ...Tag) error {
+	var encode func(idx int, r *Record) error
+	var finish func() error
+
+	switch format {
+	case FormatJSON:
+		encode = func(idx int, r *Record) error {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			sep := ",\n"
+			if idx == 0 {
+				sep = "[\n"
+			}
+			_, err = fmt.Fprintf(w, "%s%s", sep, b)
+			return err
+		}
+		finish = func() error {
+			_, err := io.WriteString(w, "\n]\n")
+			return err
+		}
+	case FormatNDJSON:
+		encode = func(idx int, r *Record) error {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\n", b)
+			return err
+		}
+	case FormatYAML:
+		encode = func(idx int, r *Record) error {
+			// Each record is encoded as a single-item sequence, concatenating
+			// these yields one sequence of all records.
+			b, err := yaml.Marshal([]*Record{r})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		}
+	default:
+		return &ErrUnsupportedFormat{string(format)}
+	}
+
+	serviceTags, err := o.ListTagsByService()
+	if err != nil {
+		return err
+	}
+
+	hasTag := func(id string) bool {
+		if len(tags) == 0 {
+			return true
+		}
+		for _, serviceTag := range serviceTags[id] {
+			for _, tag := range tags {
+				if serviceTag == tag {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	it := o.IterateServices(context.Background(), IterateOptions{
+		Sorted: true,
+		Filter: hasTag,
+	})
+	defer it.Close()
+
+	idx := 0
+	for it.Next() {
+		id, service, err := it.Service()
+		if err != nil {
+			return err
+		}
+		if err := encode(idx, &Record{
+			ID:      id,
+			Tags:    serviceTags[id],
+			Service: *service,
+		}); err != nil {
+			return err
+		}
+		idx++
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if format == FormatJSON && idx == 0 {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+	if finish != nil {
+		return finish()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package oniontree_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-yaml/yaml"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestOnionTree_Export(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	service := oniontree.NewService("dummyservice")
+	service.Name = "Dummy Service"
+	service.SetURLs([]string{"http://dummy.onion"})
+	if err := ot.AddService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []oniontree.Format{oniontree.FormatJSON, oniontree.FormatNDJSON, oniontree.FormatYAML} {
+		buf := &bytes.Buffer{}
+		if err := ot.Export(buf, format); err != nil {
+			t.Fatal(err)
+		}
+
+		records := []*oniontree.Record{}
+		switch format {
+		case oniontree.FormatJSON:
+			if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+				t.Fatal(err)
+			}
+		case oniontree.FormatNDJSON:
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				record := &oniontree.Record{}
+				if err := json.Unmarshal([]byte(line), record); err != nil {
+					t.Fatal(err)
+				}
+				records = append(records, record)
+			}
+		case oniontree.FormatYAML:
+			if err := yaml.Unmarshal(buf.Bytes(), &records); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !assert.Len(t, records, 2) {
+			t.Fatalf("%s: unexpected number of records", format)
+		}
+		assert.Equal(t, "dummyservice", records[0].ID)
+		assert.Equal(t, "Dummy Service", records[0].Name)
+		assert.Equal(t, []string{"http://dummy.onion"}, records[0].URLs)
+		assert.Empty(t, records[0].Tags)
+		assert.Equal(t, "oniontree", records[1].ID)
+		assert.Equal(t, "OnionTree", records[1].Name)
+		assert.Equal(t, []oniontree.Tag{"link_list"}, records[1].Tags)
+		assert.Len(t, records[1].PublicKeys, 1)
+	}
+}
+
+func TestOnionTree_ExportWithTag(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	buf := &bytes.Buffer{}
+	if err := ot.Export(buf, oniontree.FormatJSON, "nonexistent"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "[]\n", buf.String())
+
+	buf.Reset()
+	if err := ot.Export(buf, oniontree.FormatNDJSON, "link_list"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
+
+func TestOnionTree_ExportErrorUnsupportedFormat(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	err := ot.Export(&bytes.Buffer{}, "xml")
+	if _, ok := err.(*oniontree.ErrUnsupportedFormat); !ok {
+		t.Fatal("unexpected error", err)
+	}
+}
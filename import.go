@@ -0,0 +1,278 @@
+package oniontree
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+const (
+	FormatCSV  Format = "csv"
+	FormatText Format = "text"
+)
+
+type ImportStrategy string
+
+const (
+	// ImportSkip leaves existing services untouched.
+	ImportSkip ImportStrategy = "skip"
+	// ImportMerge adds URLs, public keys and tags to existing services,
+	// non-empty name and description replace the existing ones.
+	ImportMerge ImportStrategy = "merge"
+	// ImportOverwrite replaces existing services including their tags.
+	ImportOverwrite ImportStrategy = "overwrite"
+)
+
+type ImportAction string
+
+const (
+	ImportAdded   ImportAction = "added"
+	ImportUpdated ImportAction = "updated"
+	ImportSkipped ImportAction = "skipped"
+)
+
+type ImportOptions struct {
+	Format   Format
+	Strategy ImportStrategy
+	// Tags are added to every imported service.
+	Tags []Tag
+	// DryRun validates the records without modifying the repository.
+	DryRun bool
+}
+
+type ImportResult struct {
+	// Index is a position of the record in the input, starting at 1.
+	// It matches line numbers for line-oriented formats.
+	Index  int
+	ID     string
+	Action ImportAction
+	Err    error
+}
+
+// Import reads service records from `r` and adds them to the repository.
+// Each record is validated and its result is reported separately; the error
+// is returned only if the input cannot be read at all.
+//
+// Records in formats FormatJSON, FormatNDJSON and FormatYAML have the same
+// structure as those written by Export. FormatCSV requires a header with
+// column names "id", "name", "description", "urls" and "tags", multiple
+// URLs and tags are separated by whitespace. FormatText is a list of URLs,
+// one per line. Missing IDs and names are derived from the first URL.
+func (o OnionTree) Import(r io.Reader, opts ImportOptions) ([]*ImportResult, error) {
+	switch opts.Strategy {
+	case "":
+		opts.Strategy = ImportSkip
+	case ImportSkip, ImportMerge, ImportOverwrite:
+	default:
+		return nil, fmt.Errorf("unsupported import strategy `%s`", opts.Strategy)
+	}
+
+	results := []*ImportResult{}
+	importRecord := func(idx int, record *Record, err error) {
+		result := &ImportResult{Index: idx}
+		if err == nil {
+			result.Action, err = o.importRecord(record, opts)
+			result.ID = record.ID
+		}
+		result.Err = err
+		results = append(results, result)
+	}
+
+	switch opts.Format {
+	case FormatJSON, FormatYAML:
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		records := []*Record{}
+		if opts.Format == FormatJSON {
+			err = json.Unmarshal(b, &records)
+		} else {
+			err = yaml.Unmarshal(b, &records)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range records {
+			importRecord(i+1, records[i], nil)
+		}
+
+	case FormatNDJSON:
+		err := readLines(r, func(idx int, line string) {
+			record := &Record{}
+			err := json.Unmarshal([]byte(line), record)
+			importRecord(idx, record, err)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case FormatText:
+		err := readLines(r, func(idx int, line string) {
+			if strings.HasPrefix(line, "#") {
+				return
+			}
+			record := &Record{}
+			record.URLs = []string{line}
+			importRecord(idx, record, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		columns := map[string]int{}
+		for i := range header {
+			columns[strings.ToLower(strings.TrimSpace(header[i]))] = i
+		}
+		column := func(row []string, name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		for idx := 2; ; idx++ {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if _, ok := err.(*csv.ParseError); ok {
+					importRecord(idx, nil, err)
+					continue
+				}
+				return nil, err
+			}
+			record := &Record{ID: column(row, "id")}
+			record.Name = column(row, "name")
+			record.Description = column(row, "description")
+			record.URLs = strings.Fields(column(row, "urls"))
+			for _, tag := range strings.Fields(column(row, "tags")) {
+				record.Tags = append(record.Tags, Tag(tag))
+			}
+			importRecord(idx, record, nil)
+		}
+
+	default:
+		return nil, &ErrUnsupportedFormat{string(opts.Format)}
+	}
+
+	return results, nil
+}
+
+func (o OnionTree) importRecord(record *Record, opts ImportOptions) (ImportAction, error) {
+	if len(record.URLs) > 0 {
+		u, err := url.Parse(strings.TrimSpace(record.URLs[0]))
+		if err != nil {
+			return "", err
+		}
+		if record.ID == "" {
+			record.ID = strings.ToLower(strings.TrimSuffix(u.Hostname(), ".onion"))
+		}
+		if record.Name == "" {
+			record.Name = u.Hostname()
+		}
+	}
+	if record.ID == "" {
+		return "", errors.New("missing service ID")
+	}
+
+	service := NewService(record.ID)
+	service.Name = record.Name
+	service.Description = record.Description
+	service.AddURLs(record.URLs)
+	service.AddPublicKeys(record.PublicKeys)
+	if err := service.Validate(); err != nil {
+		return "", err
+	}
+
+	tags := append(append([]Tag{}, record.Tags...), opts.Tags...)
+	for i := range tags {
+		if err := tags[i].Validate(); err != nil {
+			return "", err
+		}
+	}
+
+	action := ImportAdded
+	existing, err := o.GetService(record.ID)
+	if err != nil {
+		if _, ok := err.(*ErrIdNotExists); !ok {
+			return "", err
+		}
+		existing = nil
+	}
+	if existing != nil {
+		switch opts.Strategy {
+		case ImportSkip:
+			return ImportSkipped, nil
+		case ImportMerge:
+			if service.Name != "" {
+				existing.Name = service.Name
+			}
+			if service.Description != "" {
+				existing.Description = service.Description
+			}
+			existing.AddURLs(service.URLs)
+			existing.AddPublicKeys(service.PublicKeys)
+			if err := existing.Validate(); err != nil {
+				return "", err
+			}
+			service = existing
+		}
+		action = ImportUpdated
+	}
+
+	if opts.DryRun {
+		return action, nil
+	}
+
+	if existing == nil {
+		if err := o.AddService(service); err != nil {
+			return "", err
+		}
+	} else {
+		if err := o.UpdateService(service); err != nil {
+			return "", err
+		}
+		if opts.Strategy == ImportOverwrite {
+			oldTags, err := o.ListServiceTags(record.ID)
+			if err != nil {
+				return "", err
+			}
+			if err := o.UntagService(record.ID, oldTags); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := o.TagService(record.ID, tags); err != nil {
+		return "", err
+	}
+	return action, nil
+}
+
+// readLines calls `fn` for each non-empty line read from `r`.
+func readLines(r io.Reader, fn func(idx int, line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for idx := 1; scanner.Scan(); idx++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fn(idx, line)
+	}
+	return scanner.Err()
+}
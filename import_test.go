@@ -0,0 +1,117 @@
+package oniontree_test
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestOnionTree_ImportNDJSON(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	input := `{"id":"dummyservice","tags":["dummy"],"name":"Dummy Service","urls":["http://dummy.onion"]}
+{"id":"invalid","name":"Invalid Service","urls":["http://clearnet.com"]}
+not a json
+
+{"id":"oniontree","name":"Renamed OnionTree","urls":["http://second.onion"]}
+`
+	results, err := ot.Import(strings.NewReader(input), oniontree.ImportOptions{
+		Format:   oniontree.FormatNDJSON,
+		Strategy: oniontree.ImportMerge,
+		Tags:     []oniontree.Tag{"imported"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Len(t, results, 4) {
+		t.Fatal("unexpected number of results")
+	}
+	assert.Equal(t, 1, results[0].Index)
+	assert.Equal(t, oniontree.ImportAdded, results[0].Action)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "invalid", results[1].ID)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, 3, results[2].Index)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, 5, results[3].Index)
+	assert.Equal(t, oniontree.ImportUpdated, results[3].Action)
+	assert.NoError(t, results[3].Err)
+
+	service := readServiceFile(t, ot, "dummyservice")
+	assert.Equal(t, "Dummy Service", service.Name)
+	tags, err := ot.ListServiceTags("dummyservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"dummy", "imported"}, tags)
+
+	service = readServiceFile(t, ot, "oniontree")
+	assert.Equal(t, "Renamed OnionTree", service.Name)
+	assert.Equal(t, []string{"http://onions53ehmf4q75.onion", "http://second.onion"}, service.URLs)
+	assert.Len(t, service.PublicKeys, 1)
+
+	_, err = ot.GetService("invalid")
+	assert.IsType(t, &oniontree.ErrIdNotExists{}, err)
+}
+
+func TestOnionTree_ImportCSV(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	input := `id,name,urls,tags
+dummyservice,Dummy Service,http://first.onion http://second.onion,dummy test
+oniontree,OnionTree,http://onions53ehmf4q75.onion,
+`
+	results, err := ot.Import(strings.NewReader(input), oniontree.ImportOptions{
+		Format: oniontree.FormatCSV,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Len(t, results, 2) {
+		t.Fatal("unexpected number of results")
+	}
+	assert.Equal(t, &oniontree.ImportResult{Index: 2, ID: "dummyservice", Action: oniontree.ImportAdded}, results[0])
+	assert.Equal(t, &oniontree.ImportResult{Index: 3, ID: "oniontree", Action: oniontree.ImportSkipped}, results[1])
+
+	service := readServiceFile(t, ot, "dummyservice")
+	assert.Equal(t, []string{"http://first.onion", "http://second.onion"}, service.URLs)
+	tags, err := ot.ListServiceTags("dummyservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"dummy", "test"}, tags)
+}
+
+func TestOnionTree_ImportTextDryRun(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	input := `# List of onions
+http://onions53ehmf4q75.onion
+http://dummy.onion
+`
+	results, err := ot.Import(strings.NewReader(input), oniontree.ImportOptions{
+		Format:   oniontree.FormatText,
+		Strategy: oniontree.ImportOverwrite,
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []*oniontree.ImportResult{
+		{Index: 2, ID: "onions53ehmf4q75", Action: oniontree.ImportAdded},
+		{Index: 3, ID: "dummy", Action: oniontree.ImportAdded},
+	}, results)
+
+	serviceIDs, err := ot.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"oniontree"}, serviceIDs)
+}
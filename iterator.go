@@ -0,0 +1,198 @@
+package oniontree
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+)
+
+type IterateOptions struct {
+	// Workers is a number of services parsed concurrently.
+	// Defaults to the number of CPUs.
+	Workers int
+	// Sorted makes the iterator return services ordered by ID. This requires
+	// reading all filenames upfront, services are still parsed lazily.
+	Sorted bool
+	// Filter, if set, skips services for which it returns false
+	// without parsing them.
+	Filter func(id string) bool
+}
+
+type iteratorItem struct {
+	id      string
+	service *Service
+	err     error
+	// fatal is set if the iteration cannot continue.
+	fatal bool
+}
+
+// ServiceIterator walks services in the repository.
+//
+//	it := ot.IterateServices(ctx, oniontree.IterateOptions{})
+//	defer it.Close()
+//	for it.Next() {
+//		id, service, err := it.Service()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ServiceIterator struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	futures <-chan chan *iteratorItem
+	current *iteratorItem
+	err     error
+}
+
+// Next advances the iterator to the next service. It returns false when
+// there are no more services, or the iteration was stopped by an error.
+func (it *ServiceIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	select {
+	case future, more := <-it.futures:
+		if !more {
+			// The producer also stops early if the context is canceled.
+			it.err = it.ctx.Err()
+			return false
+		}
+		select {
+		case item := <-future:
+			if item.fatal {
+				it.err = item.err
+				return false
+			}
+			it.current = item
+			return true
+		case <-it.ctx.Done():
+		}
+	case <-it.ctx.Done():
+	}
+	it.err = it.ctx.Err()
+	return false
+}
+
+// Service returns the current service. The error is set if the service
+// could not be read, the iteration may continue regardless.
+func (it *ServiceIterator) Service() (string, *Service, error) {
+	if it.current == nil {
+		return "", nil, nil
+	}
+	return it.current.id, it.current.service, it.current.err
+}
+
+// Err returns an error which stopped the iteration. Canceling the context
+// passed to IterateServices stops the iteration with the context's error.
+func (it *ServiceIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration and releases its resources.
+func (it *ServiceIterator) Close() {
+	it.cancel()
+}
+
+// IterateServices returns an iterator over services in the repository.
+// Unlike ListServices, filenames are read in batches as the iteration proceeds.
+func (o OnionTree) IterateServices(ctx context.Context, opts IterateOptions) *ServiceIterator {
+	const readBatchSize = 256
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	futures := make(chan chan *iteratorItem, workers)
+	it := &ServiceIterator{
+		ctx:     ctx,
+		cancel:  cancel,
+		futures: futures,
+	}
+
+	// Results are queued in the order the services were read. Each result
+	// is delivered via its own channel, so parsing can run concurrently while
+	// the iterator still returns the services in order.
+	sem := make(chan struct{}, workers)
+	enqueue := func(item *iteratorItem, parse bool) bool {
+		future := make(chan *iteratorItem, 1)
+		select {
+		case futures <- future:
+		case <-ctx.Done():
+			return false
+		}
+		if !parse {
+			future <- item
+			return true
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		go func() {
+			defer func() { <-sem }()
+			item.service, item.err = o.GetService(item.id)
+			future <- item
+		}()
+		return true
+	}
+	enqueueFilenames := func(names []string, sorted bool) bool {
+		ids := make([]string, len(names))
+		for i := range names {
+			ids[i] = o.filenameToId(names[i])
+		}
+		if sorted {
+			sort.Strings(ids)
+		}
+		for _, id := range ids {
+			if opts.Filter != nil && !opts.Filter(id) {
+				continue
+			}
+			if !enqueue(&iteratorItem{id: id}, true) {
+				return false
+			}
+		}
+		return true
+	}
+
+	go func() {
+		defer close(futures)
+
+		file, err := os.Open(o.UnsortedDir())
+		if err != nil {
+			enqueue(&iteratorItem{err: err, fatal: true}, false)
+			return
+		}
+		defer file.Close()
+
+		if opts.Sorted {
+			names, err := file.Readdirnames(0)
+			if err != nil {
+				enqueue(&iteratorItem{err: err, fatal: true}, false)
+				return
+			}
+			enqueueFilenames(names, true)
+			return
+		}
+
+		for {
+			names, err := file.Readdirnames(readBatchSize)
+			if !enqueueFilenames(names, false) {
+				return
+			}
+			if err != nil {
+				if err != io.EOF {
+					enqueue(&iteratorItem{err: err, fatal: true}, false)
+				}
+				return
+			}
+		}
+	}()
+
+	return it
+}
@@ -0,0 +1,151 @@
+package oniontree_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+func addServices(t *testing.T, ot *oniontree.OnionTree, num int) []string {
+	ids := []string{}
+	for i := 0; i < num; i++ {
+		service := oniontree.NewService(fmt.Sprintf("service-%d", i))
+		service.Name = "Service"
+		service.SetURLs([]string{"http://service.onion"})
+		if err := ot.AddService(service); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, service.ID())
+	}
+	return ids
+}
+
+func TestOnionTree_IterateServices(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	expected := append(addServices(t, ot, 600), "oniontree")
+	sort.Strings(expected)
+
+	for _, sorted := range []bool{false, true} {
+		it := ot.IterateServices(context.Background(), oniontree.IterateOptions{
+			Workers: 4,
+			Sorted:  sorted,
+		})
+
+		ids := []string{}
+		for it.Next() {
+			id, service, err := it.Service()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !assert.Equal(t, id, service.ID()) {
+				t.Fatal("unexpected service")
+			}
+			ids = append(ids, id)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		it.Close()
+
+		if !sorted {
+			sort.Strings(ids)
+		}
+		if !assert.Equal(t, expected, ids) {
+			t.Fatal("unexpected services")
+		}
+	}
+}
+
+func TestOnionTree_IterateServicesFilter(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addServices(t, ot, 10)
+
+	it := ot.IterateServices(context.Background(), oniontree.IterateOptions{
+		Sorted: true,
+		Filter: func(id string) bool {
+			return id == "oniontree"
+		},
+	})
+	defer it.Close()
+
+	ids := []string{}
+	for it.Next() {
+		id, _, _ := it.Service()
+		ids = append(ids, id)
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"oniontree"}, ids)
+}
+
+func TestOnionTree_IterateServicesError(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(ot.UnsortedDir()+"/broken.yaml", []byte("urls: ["), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	it := ot.IterateServices(context.Background(), oniontree.IterateOptions{
+		Sorted: true,
+	})
+	defer it.Close()
+
+	// Errors of individual services don't stop the iteration.
+	if !assert.True(t, it.Next()) {
+		t.Fatal("iteration stopped")
+	}
+	id, _, err := it.Service()
+	assert.Equal(t, "broken", id)
+	assert.Error(t, err)
+
+	if !assert.True(t, it.Next()) {
+		t.Fatal("iteration stopped")
+	}
+	id, _, err = it.Service()
+	assert.Equal(t, "oniontree", id)
+	assert.NoError(t, err)
+
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
+
+func TestOnionTree_IterateServicesCancel(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addServices(t, ot, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it := ot.IterateServices(ctx, oniontree.IterateOptions{
+		Workers: 2,
+	})
+	defer it.Close()
+
+	if !assert.True(t, it.Next()) {
+		t.Fatal("iteration stopped")
+	}
+	cancel()
+
+	for it.Next() {
+	}
+	assert.Equal(t, context.Canceled, it.Err())
+}
+
+func TestOnionTree_IterateServicesErrorNotOnionTree(t *testing.T) {
+	ot, cleanup := newOnionTree(t)
+	defer cleanup()
+
+	it := ot.IterateServices(context.Background(), oniontree.IterateOptions{})
+	defer it.Close()
+
+	assert.False(t, it.Next())
+	assert.Error(t, it.Err())
+}
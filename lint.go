@@ -0,0 +1,128 @@
+package oniontree
+
+import (
+	"context"
+	"github.com/oniontree-org/go-oniontree/validator"
+	"path"
+)
+
+// LintTarget is a service together with its context in the repository.
+// It's the value passed to validation rules by Lint.
+type LintTarget struct {
+	*Service
+	Tags []Tag `json:"-" yaml:"-"`
+
+	// names maps service names to IDs of services using them.
+	names map[string][]string
+}
+
+// HasTag returns true if the service is tagged with `tag`.
+func (t *LintTarget) HasTag(tag Tag) bool {
+	for i := range t.Tags {
+		if t.Tags[i] == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ServicesNamed returns IDs of all services in the repository named `name`.
+func (t *LintTarget) ServicesNamed(name string) []string {
+	return t.names[name]
+}
+
+type LintIssue struct {
+	// Path is either "unsorted/<id>" or "tagged/<tag>".
+	Path     string
+	Severity validator.Severity
+	Err      error
+}
+
+// Lint validates all services and tags in the repository. Services are validated
+// against the JSON schema and the registered rules with severities configured
+// in the repository configuration.
+func (o OnionTree) Lint(ctx context.Context) ([]*LintIssue, error) {
+	cfg, err := o.Config()
+	if err != nil {
+		return nil, err
+	}
+	severities := make(map[string]validator.Severity, len(cfg.Lint.Rules))
+	for name, s := range cfg.Lint.Rules {
+		severity, err := validator.ParseSeverity(s)
+		if err != nil {
+			return nil, err
+		}
+		severities[name] = severity
+	}
+	v, err := defaultValidator.WithRules(severities)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceTags, err := o.ListTagsByService()
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []*LintIssue{}
+	addIssue := func(pth string, severity validator.Severity, err error) {
+		issues = append(issues, &LintIssue{
+			Path:     pth,
+			Severity: severity,
+			Err:      err,
+		})
+	}
+
+	// Rules may need to look at other services, so all the services
+	// are read before any of them is validated.
+	it := o.IterateServices(ctx, IterateOptions{
+		Sorted: true,
+	})
+	defer it.Close()
+
+	targets := []*LintTarget{}
+	names := map[string][]string{}
+	for it.Next() {
+		id, service, err := it.Service()
+		if err != nil {
+			addIssue(path.Join("unsorted", id), validator.SeverityError, err)
+			continue
+		}
+		targets = append(targets, &LintTarget{
+			Service: service,
+			Tags:    serviceTags[id],
+			names:   names,
+		})
+		names[service.Name] = append(names[service.Name], id)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, target := range targets {
+		pth := path.Join("unsorted", target.ID())
+		if err := target.id.Validate(); err != nil {
+			addIssue(pth, validator.SeverityError, err)
+			continue
+		}
+		warnings, err := v.Lint(target)
+		for i := range warnings {
+			addIssue(pth, validator.SeverityWarning, warnings[i])
+		}
+		if err != nil {
+			addIssue(pth, validator.SeverityError, err)
+		}
+	}
+
+	tags, err := o.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tags {
+		if err := tags[i].Validate(); err != nil {
+			addIssue(path.Join("tagged", tags[i].String()), validator.SeverityError, err)
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,79 @@
+package oniontree_test
+
+import (
+	"context"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/validator"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOnionTree_Lint(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	service := oniontree.NewService("duplicate")
+	service.Name = "OnionTree"
+	service.Description = "Visit [us](https://example.com/?utm_source=oniontree)."
+	service.SetURLs([]string{"http://duplicate.onion"})
+	if err := ot.AddService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := ot.Lint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertIssue := func(issue *oniontree.LintIssue, pth string, severity validator.Severity, rule string) {
+		assert.Equal(t, pth, issue.Path)
+		assert.Equal(t, severity, issue.Severity)
+		if rule != "" {
+			if !assert.IsType(t, &validator.RuleError{}, issue.Err) {
+				return
+			}
+			assert.Equal(t, rule, issue.Err.(*validator.RuleError).Rule)
+		}
+	}
+
+	if !assert.Len(t, issues, 4) {
+		t.Fatal("unexpected number of issues")
+	}
+	assertIssue(issues[0], "unsorted/duplicate", validator.SeverityWarning, "no-tracking-links")
+	assertIssue(issues[1], "unsorted/duplicate", validator.SeverityWarning, "unique-names")
+	assertIssue(issues[2], "unsorted/oniontree", validator.SeverityWarning, "unique-names")
+	assertIssue(issues[3], "tagged/link_list", validator.SeverityError, "")
+}
+
+func TestOnionTree_LintConfig(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	cfg := []byte(`lint:
+  rules:
+    key-user-id-matches-name: error
+    unique-names: off
+`)
+	if err := ioutil.WriteFile(ot.Dir()+"/.oniontree", cfg, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := ot.Lint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Len(t, issues, 2) {
+		t.Fatal("unexpected number of issues")
+	}
+	assert.Equal(t, "unsorted/oniontree", issues[0].Path)
+	assert.Equal(t, validator.SeverityError, issues[0].Severity)
+	assert.Contains(t, issues[0].Err.Error(), "key-user-id-matches-name")
+
+	if err := ioutil.WriteFile(ot.Dir()+"/.oniontree", []byte("lint:\n  rules:\n    nonexistent: error\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ot.Lint(context.Background())
+	assert.Error(t, err)
+}
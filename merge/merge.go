@@ -0,0 +1,210 @@
+package merge
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"sort"
+)
+
+type Action uint8
+
+func (a Action) String() string {
+	switch a {
+	case ActionAdd:
+		return "add"
+	case ActionUpdate:
+		return "update"
+	case ActionRemove:
+		return "remove"
+	}
+	return ""
+}
+
+const (
+	ActionAdd Action = iota + 1
+	ActionUpdate
+	ActionRemove
+)
+
+// Change describes a modification of the local repository needed to bring in
+// changes made in the remote repository.
+type Change struct {
+	ServiceID string
+	Action    Action
+	// Service holds merged content of the service. It is nil for ActionRemove.
+	Service *oniontree.Service
+	// Tag is a list of tags to be added to the service.
+	Tag []oniontree.Tag
+	// Untag is a list of tags to be removed from the service.
+	Untag []oniontree.Tag
+}
+
+// Conflict describes a field changed differently in local and remote repository.
+// Conflicting fields keep their local value.
+type Conflict struct {
+	ServiceID string
+	// Field is either a service field name ("name", "description"),
+	// "public_keys/<fingerprint>" for a single public key, "tags/<tag>"
+	// for a remote tag that is not a valid tag name, or "service"
+	// if the service was removed on one side and modified on the other.
+	Field  string
+	Base   interface{}
+	Local  interface{}
+	Remote interface{}
+}
+
+type Result struct {
+	Changes   []*Change
+	Conflicts []*Conflict
+}
+
+// Merger performs a three-way merge between OnionTree repositories.
+// Repository `base` is a common ancestor of `local` and `remote`,
+// changes are always applied to `local`.
+type Merger struct {
+	base   *oniontree.OnionTree
+	local  *oniontree.OnionTree
+	remote *oniontree.OnionTree
+}
+
+// Plan computes changes and conflicts without modifying the local repository.
+func (m *Merger) Plan() (*Result, error) {
+	baseTree, err := loadTree(m.base)
+	if err != nil {
+		return nil, err
+	}
+	localTree, err := loadTree(m.local)
+	if err != nil {
+		return nil, err
+	}
+	remoteTree, err := loadTree(m.remote)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]struct{}{}
+	for _, t := range []*tree{baseTree, localTree, remoteTree} {
+		for id := range t.services {
+			ids[id] = struct{}{}
+		}
+	}
+	sortedIDs := make([]string, 0, len(ids))
+	for id := range ids {
+		sortedIDs = append(sortedIDs, id)
+	}
+	sort.Strings(sortedIDs)
+
+	result := &Result{
+		Changes:   []*Change{},
+		Conflicts: []*Conflict{},
+	}
+	for _, id := range sortedIDs {
+		change, conflicts := mergeService(id, baseTree, localTree, remoteTree)
+		if change != nil {
+			// Tags rejected by the local repository are reported instead of applied.
+			var invalid []oniontree.Tag
+			change.Tag, invalid = splitInvalidTags(change.Tag)
+			for _, tag := range invalid {
+				conflicts = append(conflicts, &Conflict{
+					ServiceID: id,
+					Field:     "tags/" + tag.String(),
+					Remote:    tag,
+				})
+			}
+			if change.Action == ActionUpdate && change.Service == nil && len(change.Tag) == 0 && len(change.Untag) == 0 {
+				change = nil
+			}
+		}
+		if change != nil {
+			result.Changes = append(result.Changes, change)
+		}
+		result.Conflicts = append(result.Conflicts, conflicts...)
+	}
+	return result, nil
+}
+
+// Apply applies changes from `r` to the local repository. Tags of all changes
+// are validated first, so that an invalid tag doesn't leave the repository half-updated.
+func (m *Merger) Apply(r *Result) error {
+	for _, change := range r.Changes {
+		for _, tags := range [][]oniontree.Tag{change.Tag, change.Untag} {
+			for _, tag := range tags {
+				if err := tag.Validate(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, change := range r.Changes {
+		switch change.Action {
+		case ActionAdd:
+			if err := m.local.AddService(change.Service); err != nil {
+				return err
+			}
+		case ActionUpdate:
+			if change.Service != nil {
+				if err := m.local.UpdateService(change.Service); err != nil {
+					return err
+				}
+			}
+		case ActionRemove:
+			if err := m.local.RemoveService(change.ServiceID); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(change.Untag) > 0 {
+			if err := m.local.UntagService(change.ServiceID, change.Untag); err != nil {
+				return err
+			}
+		}
+		if len(change.Tag) > 0 {
+			if err := m.local.TagService(change.ServiceID, change.Tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Merge computes changes and applies those without conflicts to the local repository.
+func (m *Merger) Merge() (*Result, error) {
+	r, err := m.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Apply(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// splitInvalidTags returns tags from `tags` that pass Tag.Validate and those that don't.
+func splitInvalidTags(tags []oniontree.Tag) ([]oniontree.Tag, []oniontree.Tag) {
+	var valid, invalid []oniontree.Tag
+	for i, tag := range tags {
+		if err := tag.Validate(); err != nil {
+			if invalid == nil {
+				valid = append([]oniontree.Tag{}, tags[:i]...)
+			}
+			invalid = append(invalid, tag)
+			continue
+		}
+		if invalid != nil {
+			valid = append(valid, tag)
+		}
+	}
+	if invalid == nil {
+		return tags, nil
+	}
+	return valid, invalid
+}
+
+// NewMerger returns a new Merger.
+func NewMerger(base, local, remote *oniontree.OnionTree) *Merger {
+	return &Merger{
+		base:   base,
+		local:  local,
+		remote: remote,
+	}
+}
@@ -0,0 +1,225 @@
+package merge_test
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/merge"
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func newTempDir(t *testing.T) string {
+	tmpDir, err := ioutil.TempDir("", "go-oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpDir
+}
+
+func copyOnionTree(t *testing.T) (*oniontree.OnionTree, func() error) {
+	tmpDir := newTempDir(t)
+	if err := copy.Copy("../testdata/oniontree", tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	return oniontree.New(tmpDir), func() error {
+		return os.RemoveAll(tmpDir)
+	}
+}
+
+func mustGetService(t *testing.T, ot *oniontree.OnionTree, id string) *oniontree.Service {
+	s, err := ot.GetService(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func mustUpdateService(t *testing.T, ot *oniontree.OnionTree, s *oniontree.Service) {
+	if err := ot.UpdateService(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMerger_Merge(t *testing.T) {
+	base, cleanupBase := copyOnionTree(t)
+	defer cleanupBase()
+	local, cleanupLocal := copyOnionTree(t)
+	defer cleanupLocal()
+	remote, cleanupRemote := copyOnionTree(t)
+	defer cleanupRemote()
+
+	// Local edits the description and adds a URL.
+	s := mustGetService(t, local, "oniontree")
+	s.Description = "Local description"
+	s.AddURLs([]string{"http://local.onion"})
+	mustUpdateService(t, local, s)
+
+	// Remote edits the name, adds a URL, tags the service and adds a new service.
+	s = mustGetService(t, remote, "oniontree")
+	s.Name = "Remote OnionTree"
+	s.AddURLs([]string{"http://remote.onion"})
+	mustUpdateService(t, remote, s)
+	if err := remote.TagService("oniontree", []oniontree.Tag{"directory"}); err != nil {
+		t.Fatal(err)
+	}
+	newService := oniontree.NewService("remoteservice")
+	newService.Name = "Remote Service"
+	newService.SetURLs([]string{"http://remoteservice.onion"})
+	if err := remote.AddService(newService); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := merge.NewMerger(base, local, remote).Merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Empty(t, result.Conflicts) {
+		t.Fatal("unexpected conflicts")
+	}
+	if !assert.Len(t, result.Changes, 2) {
+		t.Fatal("unexpected number of changes")
+	}
+
+	s = mustGetService(t, local, "oniontree")
+	assert.Equal(t, "Remote OnionTree", s.Name)
+	assert.Equal(t, "Local description", s.Description)
+	assert.Equal(t, []string{"http://onions53ehmf4q75.onion", "http://local.onion", "http://remote.onion"}, s.URLs)
+
+	tags, err := local.ListServiceTags("oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"directory", "link_list"}, tags)
+
+	s = mustGetService(t, local, "remoteservice")
+	assert.Equal(t, newService, s)
+}
+
+func TestMerger_MergeConflict(t *testing.T) {
+	base, cleanupBase := copyOnionTree(t)
+	defer cleanupBase()
+	local, cleanupLocal := copyOnionTree(t)
+	defer cleanupLocal()
+	remote, cleanupRemote := copyOnionTree(t)
+	defer cleanupRemote()
+
+	s := mustGetService(t, local, "oniontree")
+	s.Name = "Local OnionTree"
+	mustUpdateService(t, local, s)
+
+	s = mustGetService(t, remote, "oniontree")
+	s.Name = "Remote OnionTree"
+	s.AddURLs([]string{"http://remote.onion"})
+	mustUpdateService(t, remote, s)
+
+	result, err := merge.NewMerger(base, local, remote).Merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Equal(t, []*merge.Conflict{{
+		ServiceID: "oniontree",
+		Field:     "name",
+		Base:      "OnionTree",
+		Local:     "Local OnionTree",
+		Remote:    "Remote OnionTree",
+	}}, result.Conflicts) {
+		t.Fatal("unexpected conflicts")
+	}
+
+	// Conflicting field keeps the local value, clean changes are applied.
+	s = mustGetService(t, local, "oniontree")
+	assert.Equal(t, "Local OnionTree", s.Name)
+	assert.Equal(t, []string{"http://onions53ehmf4q75.onion", "http://remote.onion"}, s.URLs)
+}
+
+func TestMerger_MergeRemoved(t *testing.T) {
+	base, cleanupBase := copyOnionTree(t)
+	defer cleanupBase()
+	local, cleanupLocal := copyOnionTree(t)
+	defer cleanupLocal()
+	remote, cleanupRemote := copyOnionTree(t)
+	defer cleanupRemote()
+
+	if err := remote.RemoveService("oniontree"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Service modified locally must not be removed.
+	s := mustGetService(t, local, "oniontree")
+	s.Description = "Local description"
+	mustUpdateService(t, local, s)
+
+	result, err := merge.NewMerger(base, local, remote).Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, result.Conflicts, 1) || !assert.Equal(t, "service", result.Conflicts[0].Field) {
+		t.Fatal("unexpected conflicts")
+	}
+	assert.Empty(t, result.Changes)
+
+	// Unmodified service is removed.
+	result, err = merge.NewMerger(base, base, remote).Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, []*merge.Change{{
+		ServiceID: "oniontree",
+		Action:    merge.ActionRemove,
+	}}, result.Changes)
+}
+
+func TestMerger_MergeInvalidTag(t *testing.T) {
+	base, cleanupBase := copyOnionTree(t)
+	defer cleanupBase()
+	local, cleanupLocal := copyOnionTree(t)
+	defer cleanupLocal()
+	remote, cleanupRemote := copyOnionTree(t)
+	defer cleanupRemote()
+
+	// Remote adds a service tagged with a legacy tag the local repository rejects.
+	newService := oniontree.NewService("remoteservice")
+	newService.Name = "Remote Service"
+	newService.SetURLs([]string{"http://remoteservice.onion"})
+	if err := remote.AddService(newService); err != nil {
+		t.Fatal(err)
+	}
+	err := os.Symlink("../../unsorted/remoteservice.yaml", path.Join(remote.TaggedDir(), "link_list", "remoteservice.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merger := merge.NewMerger(base, local, remote)
+	result, err := merger.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*merge.Conflict{{
+		ServiceID: "remoteservice",
+		Field:     "tags/link_list",
+		Remote:    oniontree.Tag("link_list"),
+	}}, result.Conflicts)
+
+	// Apply refuses invalid tags before modifying the repository.
+	err = merger.Apply(&merge.Result{Changes: []*merge.Change{
+		{ServiceID: "remoteservice", Action: merge.ActionAdd, Service: newService},
+		{ServiceID: "oniontree", Action: merge.ActionUpdate, Tag: []oniontree.Tag{"Invalid Tag"}},
+	}})
+	assert.Error(t, err)
+	_, err = local.GetService("remoteservice")
+	assert.Error(t, err)
+
+	if err := merger.Apply(result); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, newService, mustGetService(t, local, "remoteservice"))
+	tags, err := local.ListServiceTags("remoteservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, tags)
+}
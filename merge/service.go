@@ -0,0 +1,250 @@
+package merge
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"reflect"
+)
+
+func mergeService(id string, base, local, remote *tree) (*Change, []*Conflict) {
+	b, l, r := base.services[id], local.services[id], remote.services[id]
+	bTags, lTags, rTags := base.tags[id], local.tags[id], remote.tags[id]
+
+	switch {
+	case l == nil && r == nil:
+		return nil, nil
+
+	case l == nil:
+		if b == nil {
+			// Added in remote.
+			return &Change{
+				ServiceID: id,
+				Action:    ActionAdd,
+				Service:   r,
+				Tag:       rTags,
+			}, nil
+		}
+		if equalServices(b, r) {
+			// Removed in local.
+			return nil, nil
+		}
+		return nil, []*Conflict{{ServiceID: id, Field: "service", Base: b, Local: nil, Remote: r}}
+
+	case r == nil:
+		if b == nil {
+			// Added in local.
+			return nil, nil
+		}
+		if equalServices(b, l) {
+			// Removed in remote.
+			return &Change{
+				ServiceID: id,
+				Action:    ActionRemove,
+			}, nil
+		}
+		return nil, []*Conflict{{ServiceID: id, Field: "service", Base: b, Local: l, Remote: nil}}
+	}
+
+	if b == nil {
+		// Added on both sides, merge against an empty service.
+		b = oniontree.NewService(id)
+	}
+
+	conflicts := []*Conflict{}
+	addConflict := func(field string, b, l, r interface{}) {
+		conflicts = append(conflicts, &Conflict{
+			ServiceID: id,
+			Field:     field,
+			Base:      b,
+			Local:     l,
+			Remote:    r,
+		})
+	}
+
+	merged := oniontree.NewService(id)
+	merged.Name = mergeString(b.Name, l.Name, r.Name, func() {
+		addConflict("name", b.Name, l.Name, r.Name)
+	})
+	merged.Description = mergeString(b.Description, l.Description, r.Description, func() {
+		addConflict("description", b.Description, l.Description, r.Description)
+	})
+	merged.URLs = mergeStrings(b.URLs, l.URLs, r.URLs)
+	merged.PublicKeys = mergePublicKeys(b.PublicKeys, l.PublicKeys, r.PublicKeys, func(fpr string, b, l, r *oniontree.PublicKey) {
+		addConflict("public_keys/"+fpr, b, l, r)
+	})
+
+	tags := mergeTags(bTags, lTags, rTags)
+	change := &Change{
+		ServiceID: id,
+		Action:    ActionUpdate,
+		Tag:       subtractTags(tags, lTags),
+		Untag:     subtractTags(lTags, tags),
+	}
+	if !equalServices(merged, l) {
+		change.Service = merged
+	}
+	if change.Service == nil && len(change.Tag) == 0 && len(change.Untag) == 0 {
+		change = nil
+	}
+	return change, conflicts
+}
+
+func mergeString(b, l, r string, onConflict func()) string {
+	switch {
+	case l == r, r == b:
+		return l
+	case l == b:
+		return r
+	}
+	onConflict()
+	return l
+}
+
+// mergeStrings merges lists as sets while keeping the order of the local list.
+func mergeStrings(b, l, r []string) []string {
+	inB, inL, inR := stringSet(b), stringSet(l), stringSet(r)
+	merged := []string{}
+	for _, s := range l {
+		if _, ok := inB[s]; ok {
+			if _, ok := inR[s]; !ok {
+				// Removed in remote.
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+	for _, s := range r {
+		_, okB := inB[s]
+		_, okL := inL[s]
+		if !okB && !okL {
+			// Added in remote.
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+func mergePublicKeys(b, l, r oniontree.PublicKeys, onConflict func(string, *oniontree.PublicKey, *oniontree.PublicKey, *oniontree.PublicKey)) oniontree.PublicKeys {
+	inB, inL, inR := publicKeySet(b), publicKeySet(l), publicKeySet(r)
+	merged := oniontree.PublicKeys{}
+	for _, lk := range l {
+		key := publicKeyID(lk)
+		bk, okB := inB[key]
+		rk, okR := inR[key]
+		switch {
+		case okB && !okR:
+			if !reflect.DeepEqual(bk, lk) {
+				// Modified in local, removed in remote.
+				onConflict(key, bk, lk, nil)
+				merged = append(merged, lk)
+			}
+		case okB && okR:
+			switch {
+			case reflect.DeepEqual(lk, rk), reflect.DeepEqual(rk, bk):
+				merged = append(merged, lk)
+			case reflect.DeepEqual(lk, bk):
+				merged = append(merged, rk)
+			default:
+				onConflict(key, bk, lk, rk)
+				merged = append(merged, lk)
+			}
+		case !okB && okR:
+			if !reflect.DeepEqual(lk, rk) {
+				// Added on both sides with different content.
+				onConflict(key, nil, lk, rk)
+			}
+			merged = append(merged, lk)
+		default:
+			merged = append(merged, lk)
+		}
+	}
+	for _, rk := range r {
+		key := publicKeyID(rk)
+		if _, ok := inL[key]; ok {
+			continue
+		}
+		bk, okB := inB[key]
+		switch {
+		case !okB:
+			// Added in remote.
+			merged = append(merged, rk)
+		case !reflect.DeepEqual(bk, rk):
+			// Removed in local, modified in remote.
+			onConflict(key, bk, nil, rk)
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+func mergeTags(b, l, r []oniontree.Tag) []oniontree.Tag {
+	toStrings := func(tags []oniontree.Tag) []string {
+		s := make([]string, len(tags))
+		for i := range tags {
+			s[i] = tags[i].String()
+		}
+		return s
+	}
+	merged := mergeStrings(toStrings(b), toStrings(l), toStrings(r))
+	tags := make([]oniontree.Tag, len(merged))
+	for i := range merged {
+		tags[i] = oniontree.Tag(merged[i])
+	}
+	return tags
+}
+
+// subtractTags returns tags from `a` not present in `b`.
+func subtractTags(a, b []oniontree.Tag) []oniontree.Tag {
+	diff := []oniontree.Tag{}
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x == y {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
+
+func equalServices(a, b *oniontree.Service) bool {
+	if a.Name != b.Name || a.Description != b.Description {
+		return false
+	}
+	if !reflect.DeepEqual(stringSet(a.URLs), stringSet(b.URLs)) {
+		return false
+	}
+	return reflect.DeepEqual(publicKeySet(a.PublicKeys), publicKeySet(b.PublicKeys))
+}
+
+func stringSet(ss []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		set[s] = struct{}{}
+	}
+	return set
+}
+
+// publicKeyID returns a value identifying a public key across repositories.
+func publicKeyID(pk *oniontree.PublicKey) string {
+	switch {
+	case pk.Fingerprint != "":
+		return pk.Fingerprint
+	case pk.ID != "":
+		return pk.ID
+	}
+	return pk.Value
+}
+
+func publicKeySet(pks oniontree.PublicKeys) map[string]*oniontree.PublicKey {
+	set := make(map[string]*oniontree.PublicKey, len(pks))
+	for _, pk := range pks {
+		set[publicKeyID(pk)] = pk
+	}
+	return set
+}
@@ -0,0 +1,42 @@
+package merge
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+)
+
+type tree struct {
+	services map[string]*oniontree.Service
+	tags     map[string][]oniontree.Tag
+}
+
+func loadTree(ot *oniontree.OnionTree) (*tree, error) {
+	t := &tree{
+		services: map[string]*oniontree.Service{},
+		tags:     map[string][]oniontree.Tag{},
+	}
+	ids, err := ot.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		s, err := ot.GetService(id)
+		if err != nil {
+			return nil, err
+		}
+		t.services[id] = s
+	}
+	tags, err := ot.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		ids, err := ot.ListServicesWithTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			t.tags[id] = append(t.tags[id], tag)
+		}
+	}
+	return t, nil
+}
@@ -3,12 +3,13 @@ package oniontree
 import (
 	"fmt"
 	"github.com/go-yaml/yaml"
-	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -18,6 +19,13 @@ const (
 type OnionTree struct {
 	dir    string
 	format string
+	cache  *serviceCache
+}
+
+// EnableCache makes GetService keep parsed services in memory. A cached service
+// is returned as long as its file's modification time and size don't change.
+func (o *OnionTree) EnableCache() {
+	o.cache = newServiceCache()
 }
 
 // Init initializes empty repository.
@@ -40,6 +48,7 @@ func (o OnionTree) AddService(s *Service) error {
 	if err := s.Validate(); err != nil {
 		return err
 	}
+	o.invalidateCache(s.ID())
 	pth := path.Join(o.UnsortedDir(), o.idToFilename(s.ID()))
 	file, err := os.OpenFile(pth, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
 	if err != nil {
@@ -68,6 +77,7 @@ func (o OnionTree) RemoveService(id string) error {
 	if err := o.UntagService(id, tags); err != nil {
 		return err
 	}
+	o.invalidateCache(id)
 	pth := path.Join(o.UnsortedDir(), o.idToFilename(id))
 	if err := os.Remove(pth); err != nil {
 		if os.IsNotExist(err) {
@@ -83,6 +93,7 @@ func (o OnionTree) UpdateService(s *Service) error {
 	if err := s.Validate(); err != nil {
 		return err
 	}
+	o.invalidateCache(s.ID())
 	pth := path.Join(o.UnsortedDir(), o.idToFilename(s.ID()))
 	file, err := os.OpenFile(pth, os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
@@ -104,7 +115,22 @@ func (o OnionTree) UpdateService(s *Service) error {
 
 // GetService returns content of service `id`.
 func (o OnionTree) GetService(id string) (*Service, error) {
-	data, err := o.GetServiceBytes(id)
+	file, err := o.openServiceFile(id)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var fi os.FileInfo
+	if o.cache != nil {
+		fi, err = file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := o.cache.get(id, fi); ok {
+			return s, nil
+		}
+	}
+	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		return nil, err
 	}
@@ -112,11 +138,23 @@ func (o OnionTree) GetService(id string) (*Service, error) {
 	if err := o.unmarshalData(data, &s); err != nil {
 		return nil, err
 	}
+	if o.cache != nil {
+		o.cache.put(id, fi, s)
+	}
 	return s, nil
 }
 
 // GetServiceBytes returns raw bytes of service `id`.
 func (o OnionTree) GetServiceBytes(id string) ([]byte, error) {
+	file, err := o.openServiceFile(id)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+func (o OnionTree) openServiceFile(id string) (*os.File, error) {
 	pth := path.Join(o.UnsortedDir(), o.idToFilename(id))
 	file, err := os.Open(pth)
 	if err != nil {
@@ -125,20 +163,7 @@ func (o OnionTree) GetServiceBytes(id string) ([]byte, error) {
 		}
 		return nil, err
 	}
-	defer file.Close()
-	data := []byte{}
-	buff := make([]byte, 1024)
-	for {
-		num, err := file.Read(buff)
-		if err != nil {
-			if err != io.EOF {
-				return nil, err
-			}
-			break
-		}
-		data = append(data, buff[:num]...)
-	}
-	return data, nil
+	return file, nil
 }
 
 // ListServices returns a list of service IDs found in the repository.
@@ -160,6 +185,7 @@ func (o OnionTree) ListServices() ([]string, error) {
 }
 
 // ListServicesWithTag returns a list of services tagged with `tag`.
+// Services tagged only with child tags of `tag` are not included.
 func (o OnionTree) ListServicesWithTag(tag Tag) ([]string, error) {
 	pth := path.Join(o.TaggedDir(), tag.String())
 	file, err := os.Open(pth)
@@ -170,34 +196,147 @@ func (o OnionTree) ListServicesWithTag(tag Tag) ([]string, error) {
 		return nil, err
 	}
 	defer file.Close()
-	services, err := file.Readdirnames(0)
+	files, err := file.Readdir(0)
 	if err != nil {
 		return nil, err
 	}
-	for idx, _ := range services {
-		services[idx] = o.filenameToId(services[idx])
+	services := make([]string, 0, len(files))
+	for i := range files {
+		// Directories are child tags.
+		if files[i].IsDir() {
+			continue
+		}
+		services = append(services, o.filenameToId(files[i].Name()))
 	}
 	sort.Strings(services)
 	return services, nil
 }
 
-// ListTags returns a list of tags found in the repository.
-func (o OnionTree) ListTags() ([]Tag, error) {
-	file, err := os.Open(o.TaggedDir())
+// ListServicesWithTagRecursive returns a list of services tagged with `tag`,
+// or with any of its descendants. Descendants are both nested tags and tags
+// whose metadata name `tag` as a parent.
+func (o OnionTree) ListServicesWithTagRecursive(tag Tag) ([]string, error) {
+	tags, err := o.ListTags()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	files, err := file.Readdirnames(0)
+	found := false
+	serviceIDs := map[string]struct{}{}
+	for i := range tags {
+		if tags[i] != tag {
+			ancestors, err := o.tagAncestors(tags[i])
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := ancestors[tag]; !ok {
+				continue
+			}
+		}
+		found = true
+		ids, err := o.ListServicesWithTag(tags[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			serviceIDs[id] = struct{}{}
+		}
+	}
+	if !found {
+		return nil, &ErrTagNotExists{tag}
+	}
+	services := make([]string, 0, len(serviceIDs))
+	for id := range serviceIDs {
+		services = append(services, id)
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// tagAncestors returns all ancestors of tag `tag` given by both its name
+// and parents set in tag metadata.
+func (o OnionTree) tagAncestors(tag Tag) (map[Tag]struct{}, error) {
+	ancestors := map[Tag]struct{}{}
+	queue := []Tag{tag}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		parents := []Tag{}
+		if parent := t.Parent(); parent != "" {
+			parents = append(parents, parent)
+		}
+		metadata, err := o.GetTagMetadata(t)
+		if err != nil {
+			if _, ok := err.(*ErrTagMetadataNotExists); !ok {
+				return nil, err
+			}
+		} else if metadata.Parent != "" {
+			parents = append(parents, metadata.Parent)
+		}
+		for _, parent := range parents {
+			if _, ok := ancestors[parent]; ok || parent == tag {
+				continue
+			}
+			ancestors[parent] = struct{}{}
+			queue = append(queue, parent)
+		}
+	}
+	return ancestors, nil
+}
+
+// ListTags returns a list of tags found in the repository, including nested tags.
+func (o OnionTree) ListTags() ([]Tag, error) {
+	tags := []Tag{}
+	var walk func(dir string, parent Tag) error
+	walk = func(dir string, parent Tag) error {
+		file, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		files, err := file.Readdir(0)
+		if err != nil {
+			return err
+		}
+		for i := range files {
+			// Hidden directories are used for temporary data.
+			if !files[i].IsDir() || strings.HasPrefix(files[i].Name(), ".") {
+				continue
+			}
+			tag := Tag(path.Join(parent.String(), files[i].Name()))
+			tags = append(tags, tag)
+			if err := walk(path.Join(dir, files[i].Name()), tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(o.TaggedDir(), ""); err != nil {
+		return nil, err
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i] < tags[j]
+	})
+	return tags, nil
+}
+
+// ListTagsByService returns tags of all services in the repository indexed by service ID.
+// Unlike ListServiceTags, it walks the tagged directory only once.
+func (o OnionTree) ListTagsByService() (map[string][]Tag, error) {
+	tags, err := o.ListTags()
 	if err != nil {
 		return nil, err
 	}
-	sort.Strings(files)
-	tags := make([]Tag, len(files))
-	for i := range files {
-		tags[i] = Tag(files[i])
+	serviceTags := map[string][]Tag{}
+	for i := range tags {
+		serviceIDs, err := o.ListServicesWithTag(tags[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range serviceIDs {
+			serviceTags[id] = append(serviceTags[id], tags[i])
+		}
 	}
-	return tags, nil
+	return serviceTags, nil
 }
 
 // ListServiceTags returns tags of service `id`.
@@ -236,11 +375,9 @@ func (o OnionTree) TagService(id string, tags []Tag) error {
 			return &ErrIdNotExists{id}
 		}
 		pthTag := path.Join(o.TaggedDir(), tag.String())
-		// Create tag directory, ignore error if it already exists.
-		if err := os.Mkdir(pthTag, 0755); err != nil {
-			if !os.IsExist(err) {
-				return err
-			}
+		// Create tag directory including its parents, ignore error if it already exists.
+		if err := os.MkdirAll(pthTag, 0755); err != nil {
+			return err
 		}
 		pthRel, err := filepath.Rel(pthTag, pth)
 		if err != nil {
@@ -271,10 +408,159 @@ func (o OnionTree) UntagService(id string, tags []Tag) error {
 				return err
 			}
 		}
-		if isEmptyDir(pthTag) {
-			if err := os.Remove(pthTag); err != nil {
+		if err := o.removeEmptyTagDirs(pthTag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameTag renames tag `oldTag` to `newTag` including its nested tags and metadata.
+// Tags with `oldTag` as their parent in metadata are updated to point to `newTag`.
+// The tag `newTag` must not exist. The tag directory appears under the new name
+// at once, so services never seem to be tagged with only a part of the tag.
+func (o OnionTree) RenameTag(oldTag, newTag Tag) error {
+	if err := newTag.Validate(); err != nil {
+		return err
+	}
+	pthOld := path.Join(o.TaggedDir(), oldTag.String())
+	pthNew := path.Join(o.TaggedDir(), newTag.String())
+	if !o.isTagDir(pthOld) {
+		return &ErrTagNotExists{oldTag}
+	}
+	if isDir(pthNew) {
+		return &ErrTagExists{newTag}
+	}
+	if oldTag == newTag || newTag.IsChildOf(oldTag) {
+		return &ErrTagParentCycle{newTag}
+	}
+	if err := os.MkdirAll(path.Dir(pthNew), 0755); err != nil {
+		return err
+	}
+
+	// Symbolic links are relative, they stay valid as long as the depth
+	// of the tag doesn't change.
+	if strings.Count(oldTag.String(), "/") == strings.Count(newTag.String(), "/") {
+		if err := os.Rename(pthOld, pthNew); err != nil {
+			return err
+		}
+	} else {
+		// Build the tag in a hidden directory next to the destination,
+		// recreating the links, then move it into place.
+		pthTmp, err := ioutil.TempDir(path.Dir(pthNew), ".rename-")
+		if err != nil {
+			return err
+		}
+		if err := o.copyTagDir(pthOld, pthTmp); err != nil {
+			_ = os.RemoveAll(pthTmp)
+			return err
+		}
+		if err := os.Rename(pthTmp, pthNew); err != nil {
+			_ = os.RemoveAll(pthTmp)
+			return err
+		}
+		if err := o.removeTagDir(pthOld); err != nil {
+			return err
+		}
+	}
+	if err := o.removeEmptyTagDirs(path.Dir(pthOld)); err != nil {
+		return err
+	}
+	if err := o.renameTagMetadata(oldTag, newTag); err != nil {
+		return err
+	}
+	return o.replaceTagParents(oldTag, newTag)
+}
+
+// DeleteTag removes tag `tag` including its nested tags and metadata from all services.
+// Tags with `tag` as their parent in metadata are left without a parent.
+func (o OnionTree) DeleteTag(tag Tag) error {
+	pth := path.Join(o.TaggedDir(), tag.String())
+	if !o.isTagDir(pth) {
+		return &ErrTagNotExists{tag}
+	}
+	if err := o.removeTagDir(pth); err != nil {
+		return err
+	}
+	if err := o.removeEmptyTagDirs(path.Dir(pth)); err != nil {
+		return err
+	}
+	if err := o.RemoveTagMetadata(tag); err != nil {
+		if _, ok := err.(*ErrTagMetadataNotExists); !ok {
+			return err
+		}
+	}
+	if err := os.RemoveAll(path.Join(o.TagsDir(), tag.String())); err != nil {
+		return err
+	}
+	return o.replaceTagParents(tag, "")
+}
+
+// isTagDir returns true if `pth` is an existing tag directory.
+func (o OnionTree) isTagDir(pth string) bool {
+	return strings.HasPrefix(pth, o.TaggedDir()+"/") && isDir(pth)
+}
+
+// removeTagDir moves tag directory `pth` out of the way first, so that
+// the tag disappears at once, then removes it.
+func (o OnionTree) removeTagDir(pth string) error {
+	pthTmp := path.Join(o.TaggedDir(), fmt.Sprintf(".remove-%d", time.Now().UnixNano()))
+	if err := os.Rename(pth, pthTmp); err != nil {
+		return err
+	}
+	return os.RemoveAll(pthTmp)
+}
+
+// removeEmptyTagDirs removes tag directory `pth` if it's empty, and so on up the hierarchy.
+func (o OnionTree) removeEmptyTagDirs(pth string) error {
+	for dir := pth; strings.HasPrefix(dir, o.TaggedDir()+"/") && isEmptyDir(dir); dir = path.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTagDir recreates tag directory `src` in `dst` with symbolic links relative to `dst`.
+func (o OnionTree) copyTagDir(src, dst string) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for i := range files {
+		name := files[i].Name()
+		if files[i].IsDir() {
+			if err := os.Mkdir(path.Join(dst, name), 0755); err != nil {
+				return err
+			}
+			if err := o.copyTagDir(path.Join(src, name), path.Join(dst, name)); err != nil {
 				return err
 			}
+			continue
+		}
+		pthRel, err := filepath.Rel(dst, path.Join(o.UnsortedDir(), name))
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(pthRel, path.Join(dst, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o OnionTree) renameTagMetadata(oldTag, newTag Tag) error {
+	for _, ext := range []string{"." + o.format, ""} {
+		pthOld := path.Join(o.TagsDir(), oldTag.String()+ext)
+		pthNew := path.Join(o.TagsDir(), newTag.String()+ext)
+		if _, err := os.Lstat(pthOld); err != nil {
+			continue
+		}
+		if err := os.MkdirAll(path.Dir(pthNew), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(pthOld, pthNew); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -292,6 +578,12 @@ func (o OnionTree) TaggedDir() string {
 	return path.Join(o.dir, "tagged")
 }
 
+func (o OnionTree) invalidateCache(id string) {
+	if o.cache != nil {
+		o.cache.invalidate(id)
+	}
+}
+
 func (o OnionTree) marshalData(data interface{}) (b []byte, err error) {
 	switch o.format {
 	case "yaml":
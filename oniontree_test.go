@@ -13,7 +13,7 @@ import (
 	"testing"
 )
 
-func newTempDir(t *testing.T) string {
+func newTempDir(t testing.TB) string {
 	tmpDir, err := ioutil.TempDir("", "go-oniontree")
 	if err != nil {
 		t.Fatal(err)
@@ -28,7 +28,7 @@ func newOnionTree(t *testing.T) (*oniontree.OnionTree, func() error) {
 	}
 }
 
-func copyOnionTree(t *testing.T) (*oniontree.OnionTree, func() error) {
+func copyOnionTree(t testing.TB) (*oniontree.OnionTree, func() error) {
 	tmpDir := newTempDir(t)
 	if err := copy.Copy("testdata/oniontree", tmpDir); err != nil {
 		t.Fatal(err)
@@ -379,6 +379,24 @@ func TestOnionTree_ListServiceTags(t *testing.T) {
 	}
 }
 
+func TestOnionTree_ListTagsByService(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	tagsExpected := map[string][]oniontree.Tag{
+		"oniontree": {"link_list"},
+	}
+
+	tagsActual, err := ot.ListTagsByService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Equal(t, tagsExpected, tagsActual) {
+		t.Fatal(err)
+	}
+}
+
 func TestOnionTree_TagService(t *testing.T) {
 	ot, cleanup := copyOnionTree(t)
 	defer cleanup()
@@ -0,0 +1,106 @@
+package oniontree
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree/validator"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	validator.RegisterRule("dead-has-urls", validator.SeverityError, ruleDeadHasURLs)
+	validator.RegisterRule("no-tracking-links", validator.SeverityWarning, ruleNoTrackingLinks)
+	validator.RegisterRule("unique-names", validator.SeverityWarning, ruleUniqueNames)
+	validator.RegisterRule("key-user-id-matches-name", validator.SeverityOff, ruleKeyUserIDMatchesName)
+}
+
+// ruleDeadHasURLs requires services tagged `dead` to keep their URLs.
+func ruleDeadHasURLs(value interface{}) error {
+	t, ok := value.(*LintTarget)
+	if !ok || !t.HasTag("dead") {
+		return nil
+	}
+	if len(t.URLs) == 0 {
+		return errors.New("dead service must keep its URLs")
+	}
+	return nil
+}
+
+var (
+	linkPattern    = regexp.MustCompile(`https?://[^\s)\]>"']+`)
+	trackingParams = []string{"utm_", "fbclid", "gclid", "mc_eid", "yclid", "_hsenc"}
+	trackingHosts  = []string{
+		"google-analytics.com",
+		"doubleclick.net",
+		"googletagmanager.com",
+		"facebook.com",
+		"bit.ly",
+		"t.co",
+	}
+)
+
+// ruleNoTrackingLinks forbids clearnet links with tracking parameters,
+// or links to known trackers and link shorteners in the description.
+func ruleNoTrackingLinks(value interface{}) error {
+	t, ok := value.(*LintTarget)
+	if !ok {
+		return nil
+	}
+	for _, link := range linkPattern.FindAllString(t.Description, -1) {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if strings.HasSuffix(host, ".onion") {
+			continue
+		}
+		for _, trackingHost := range trackingHosts {
+			if host == trackingHost || strings.HasSuffix(host, "."+trackingHost) {
+				return fmt.Errorf("description contains tracking link `%s`", link)
+			}
+		}
+		for param := range u.Query() {
+			for _, prefix := range trackingParams {
+				if strings.HasPrefix(strings.ToLower(param), prefix) {
+					return fmt.Errorf("description contains tracking link `%s`", link)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ruleUniqueNames forbids services with the same name.
+func ruleUniqueNames(value interface{}) error {
+	t, ok := value.(*LintTarget)
+	if !ok {
+		return nil
+	}
+	others := []string{}
+	for _, id := range t.ServicesNamed(t.Name) {
+		if id != t.ID() {
+			others = append(others, id)
+		}
+	}
+	if len(others) > 0 {
+		return fmt.Errorf("name `%s` is also used by %s", t.Name, strings.Join(others, ", "))
+	}
+	return nil
+}
+
+// ruleKeyUserIDMatchesName requires user IDs of public keys to contain the service name.
+func ruleKeyUserIDMatchesName(value interface{}) error {
+	t, ok := value.(*LintTarget)
+	if !ok {
+		return nil
+	}
+	for _, pk := range t.PublicKeys {
+		if !strings.Contains(strings.ToLower(pk.UserID), strings.ToLower(t.Name)) {
+			return fmt.Errorf("user ID `%s` of public key `%s` does not match the service name", pk.UserID, pk.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Backoff sets intervals between retries of a failed ping.
+type Backoff interface {
+	// Duration returns time to wait before retry `retry`, starting at 1,
+	// given the base interval and the previous wait.
+	Duration(retry int, base, prev time.Duration) time.Duration
+}
+
+// FixedBackoff waits the base interval before each retry.
+type FixedBackoff struct {
+	// Jitter is a fraction of the interval randomly subtracted from it.
+	Jitter float64
+}
+
+func (b FixedBackoff) Duration(retry int, base, prev time.Duration) time.Duration {
+	return jitter(base, b.Jitter)
+}
+
+// ExponentialBackoff multiplies the base interval by Multiplier with each retry.
+type ExponentialBackoff struct {
+	// Multiplier defaults to 2.
+	Multiplier float64
+	// Max limits the interval, if set.
+	Max time.Duration
+	// Jitter is a fraction of the interval randomly subtracted from it.
+	Jitter float64
+}
+
+func (b ExponentialBackoff) Duration(retry int, base, prev time.Duration) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(base)
+	for i := 1; i < retry; i++ {
+		d *= multiplier
+		if b.Max > 0 && d > float64(b.Max) {
+			break
+		}
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	return jitter(time.Duration(d), b.Jitter)
+}
+
+// DecorrelatedBackoff waits a random time between the base interval
+// and three times the previous wait.
+type DecorrelatedBackoff struct {
+	// Max limits the interval, if set.
+	Max time.Duration
+}
+
+func (b DecorrelatedBackoff) Duration(retry int, base, prev time.Duration) time.Duration {
+	if prev < base {
+		prev = base
+	}
+	d := base + randDuration(3*prev-base)
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// Default parameters of backoffs returned by ParseBackoff and of DefaultWorkerConfig.
+const (
+	defaultBackoffMax    = 1 * time.Minute
+	defaultBackoffJitter = 0.2
+)
+
+// ParseBackoff returns a backoff given by name "fixed", "exponential"
+// or "decorrelated" with default parameters, i.e. limited to a minute
+// and with jitter of 0.2.
+func ParseBackoff(name string) (Backoff, error) {
+	switch name {
+	case "fixed":
+		return FixedBackoff{Jitter: defaultBackoffJitter}, nil
+	case "exponential":
+		return ExponentialBackoff{Max: defaultBackoffMax, Jitter: defaultBackoffJitter}, nil
+	case "decorrelated":
+		return DecorrelatedBackoff{Max: defaultBackoffMax}, nil
+	}
+	return nil, fmt.Errorf("unsupported backoff `%s`", name)
+}
+
+// jitter returns `d` with a random fraction up to `fraction` subtracted from it.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return d - time.Duration(rand.Float64()*fraction*float64(d))
+}
+
+// randDuration returns a random duration in range [0, max).
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,75 @@
+package scanner_test
+
+import (
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFixedBackoff_Duration(t *testing.T) {
+	assert.Equal(t, time.Second, scanner.FixedBackoff{}.Duration(3, time.Second, time.Second))
+
+	backoff := scanner.FixedBackoff{Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := backoff.Duration(1, time.Second, 0)
+		assert.True(t, d >= 500*time.Millisecond && d <= time.Second, "got %s", d)
+	}
+}
+
+func TestExponentialBackoff_Duration(t *testing.T) {
+	backoff := scanner.ExponentialBackoff{Max: 5 * time.Second}
+	expected := []time.Duration{
+		1 * time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for i, d := range expected {
+		assert.Equal(t, d, backoff.Duration(i+1, time.Second, 0))
+	}
+
+	backoff = scanner.ExponentialBackoff{Multiplier: 3, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		d := backoff.Duration(3, time.Second, 0)
+		assert.True(t, d >= 7200*time.Millisecond && d <= 9*time.Second, "got %s", d)
+	}
+}
+
+func TestDecorrelatedBackoff_Duration(t *testing.T) {
+	backoff := scanner.DecorrelatedBackoff{Max: 10 * time.Second}
+	prev := time.Duration(0)
+	for i := 1; i <= 100; i++ {
+		d := backoff.Duration(i, time.Second, prev)
+		upper := 3 * prev
+		if upper < time.Second {
+			upper = 3 * time.Second
+		}
+		if upper > backoff.Max {
+			upper = backoff.Max
+		}
+		assert.True(t, d >= time.Second && d <= upper, "got %s after %s", d, prev)
+		prev = d
+	}
+}
+
+func TestParseBackoff(t *testing.T) {
+	backoff, err := scanner.ParseBackoff("exponential")
+	if assert.NoError(t, err) {
+		assert.Equal(t, scanner.DefaultWorkerConfig.RetryBackoff, backoff)
+	}
+
+	backoff, err = scanner.ParseBackoff("fixed")
+	if assert.NoError(t, err) {
+		assert.Equal(t, scanner.FixedBackoff{Jitter: 0.2}, backoff)
+	}
+
+	backoff, err = scanner.ParseBackoff("decorrelated")
+	if assert.NoError(t, err) {
+		assert.Equal(t, scanner.DecorrelatedBackoff{Max: time.Minute}, backoff)
+	}
+
+	_, err = scanner.ParseBackoff("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/proxy"
+	"net"
+)
+
+// Dialer connects to the services. It's satisfied by dialers from package
+// golang.org/x/net/proxy, as well as net.Dialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// ErrDirectConnection is returned by Scanner.Start if no proxy is configured
+// and ScannerConfig.AllowDirect is not set.
+var ErrDirectConnection = errors.New("no proxy configured, refusing to connect directly")
+
+// dialerFunc adapts a function to Dialer.
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// contextDialer returns `d` as Dialer. Dialers that don't
+// support contexts are wrapped so that the dial is abandoned once the context
+// is done.
+func contextDialer(d proxy.Dialer) Dialer {
+	if cd, ok := d.(Dialer); ok {
+		return cd
+	}
+	return dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		resultCh := make(chan result, 1)
+		go func() {
+			conn, err := d.Dial(network, address)
+			resultCh <- result{conn, err}
+		}()
+		select {
+		case r := <-resultCh:
+			return r.conn, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-resultCh; r.conn != nil {
+					_ = r.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// newDialer returns a function returning a dialer used to connect to URLs
+// of service `serviceID`. The dialer is chosen in order: ScannerConfig.Dialer,
+// SOCKS5 proxy at ScannerConfig.ProxyAddress, proxy set by environment
+// variable ALL_PROXY. If none of them is set, ErrDirectConnection is returned
+// unless ScannerConfig.AllowDirect is true.
+func newDialer(cfg ScannerConfig) (func(serviceID string) Dialer, error) {
+	if cfg.Dialer != nil {
+		return func(string) Dialer {
+			return cfg.Dialer
+		}, nil
+	}
+
+	if cfg.ProxyAddress != "" {
+		if _, _, err := net.SplitHostPort(cfg.ProxyAddress); err != nil {
+			return nil, fmt.Errorf("invalid proxy address: %s", err)
+		}
+		return func(serviceID string) Dialer {
+			var auth *proxy.Auth
+			if cfg.IsolateStreams {
+				// Tor assigns streams with different SOCKS5 credentials
+				// to different circuits.
+				auth = &proxy.Auth{
+					User:     serviceID,
+					Password: serviceID,
+				}
+			}
+			// proxy.SOCKS5 never returns an error.
+			d, _ := proxy.SOCKS5("tcp", cfg.ProxyAddress, auth, proxy.Direct)
+			return contextDialer(d)
+		}, nil
+	}
+
+	d := proxy.FromEnvironment()
+	if d == proxy.Direct && !cfg.AllowDirect {
+		return nil, ErrDirectConnection
+	}
+	return func(string) Dialer {
+		return contextDialer(d)
+	}, nil
+}
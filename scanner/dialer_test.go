@@ -0,0 +1,123 @@
+package scanner_test
+
+import (
+	"context"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// startSOCKS5Server starts a SOCKS5 server that requires username/password
+// authentication, sends received usernames to the returned channel and refuses
+// all connection requests.
+func startSOCKS5Server(t *testing.T) (string, <-chan string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usernameCh := make(chan string, 16)
+
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		buf := make([]byte, 512)
+		// Greeting: VER NMETHODS METHODS...
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			return
+		}
+		// Select username/password authentication.
+		if _, err := conn.Write([]byte{0x05, 0x02}); err != nil {
+			return
+		}
+		// Authentication: VER ULEN UNAME PLEN PASSWD
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		username := make([]byte, buf[1])
+		if _, err := io.ReadFull(conn, username); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[0]]); err != nil {
+			return
+		}
+		usernameCh <- string(username)
+		if _, err := conn.Write([]byte{0x01, 0x00}); err != nil {
+			return
+		}
+		// Refuse the request: general SOCKS server failure.
+		_, _ = conn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	return ln.Addr().String(), usernameCh, func() {
+		_ = ln.Close()
+	}
+}
+
+func TestScanner_StartIsolateStreams(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addr, usernameCh, stop := startSOCKS5Server(t)
+	defer stop()
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.ProxyAddress = addr
+	cfg.IsolateStreams = true
+	cfg.WorkerConfig.StartJitter = 0
+
+	eventCh := make(chan scanner.Event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scnr := scanner.NewScanner(cfg)
+
+	go func() {
+		_ = scnr.Start(ctx, ot.Dir(), eventCh)
+	}()
+	go func() {
+		for range eventCh {
+		}
+	}()
+
+	select {
+	case username := <-usernameCh:
+		assert.Equal(t, "oniontree", username)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection to the proxy")
+	}
+}
+
+func TestScanner_StartErrorDirectConnection(t *testing.T) {
+	if os.Getenv("ALL_PROXY") != "" || os.Getenv("all_proxy") != "" {
+		t.Skip("proxy is set by the environment")
+	}
+
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	// No proxy is set by default.
+	scnr := scanner.NewScanner(scanner.DefaultScannerConfig)
+
+	err := scnr.Start(context.Background(), ot.Dir(), make(chan scanner.Event))
+	assert.Equal(t, scanner.ErrDirectConnection, err)
+}
@@ -1,5 +1,10 @@
 package scanner
 
+import (
+	"context"
+	"time"
+)
+
 type Event interface{}
 
 type ScanEvent struct {
@@ -8,6 +13,33 @@ type ScanEvent struct {
 	ServiceID string
 	Directory string
 	Error     error
+	// Probe holds details of the response, it's set only by ProbeHTTP.
+	Probe *ProbeResult
+	// ConnectTime is time it took to establish the connection.
+	ConnectTime time.Duration
+	// TTFB is time from sending the request to receiving the first byte
+	// of the response, it's set only by ProbeHTTP.
+	TTFB time.Duration
+	// Attempts is a number of attempts made before the status was determined.
+	Attempts int
+}
+
+// Stopped returns true if the event was emitted by a worker being stopped.
+// Such events report the URL offline, consumers tracking the status
+// of URLs should ignore them.
+func (e ScanEvent) Stopped() bool {
+	return e.Error == context.Canceled
+}
+
+// Transition is a change of the status of a URL, as recorded by consumers
+// of ScanEvents, e.g. package evthistory.
+type Transition struct {
+	Time      time.Time
+	ServiceID string
+	URL       string
+	Status    Status
+	// Error describes why the URL is offline.
+	Error string
 }
 
 type (
@@ -23,9 +55,13 @@ type (
 	}
 
 	workerStatus struct {
-		Status Status
-		URL    string
-		Error  error
+		Status      Status
+		URL         string
+		Error       error
+		Probe       *ProbeResult
+		ConnectTime time.Duration
+		TTFB        time.Duration
+		Attempts    int
 	}
 )
 
@@ -40,9 +76,13 @@ type (
 	}
 
 	processStatus struct {
-		Status    Status
-		URL       string
-		ServiceID string
-		Error     error
+		Status      Status
+		URL         string
+		ServiceID   string
+		Error       error
+		Probe       *ProbeResult
+		ConnectTime time.Duration
+		TTFB        time.Duration
+		Attempts    int
 	}
 )
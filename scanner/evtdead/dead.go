@@ -0,0 +1,265 @@
+// Package evtdead tags services with scanner.DeadTag once all their URLs
+// have been offline for a configured duration, and untags them once any
+// of their URLs is back online.
+package evtdead
+
+import (
+	"context"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"log"
+	"sort"
+	"time"
+)
+
+type Config struct {
+	// Threshold is how long all URLs of a service must be offline
+	// before the service is tagged dead.
+	Threshold time.Duration
+	// TagThresholds overrides Threshold for services tagged with the tag or
+	// any of its descendants. If more tags match, the longest threshold is used.
+	TagThresholds map[oniontree.Tag]time.Duration
+	// DryRun makes the tagger only log the changes, the repository is not modified.
+	DryRun bool
+	// Logger logs the changes, defaults to the standard logger.
+	Logger *log.Logger
+	// History, if set, tells since when a URL is offline when the tagger sees it
+	// for the first time, so that the time offline survives restarts.
+	History History
+}
+
+// History provides past status transitions of URLs, e.g. evthistory.History.
+type History interface {
+	Query(url string, from, to time.Time) ([]scanner.Transition, error)
+}
+
+var DefaultConfig = Config{
+	Threshold: 7 * 24 * time.Hour,
+}
+
+// Tagger consumes scanner events. A service is checked whenever a result of
+// its URL arrives, hence the scanner must be configured with ScanDead
+// for the services to be untagged. A service is tagged dead only once all
+// URLs listed in its file are known to be offline.
+type Tagger struct {
+	ot     *oniontree.OnionTree
+	config Config
+	// Format: offlineSince[serviceID][url] = time, zero if the URL is not known to be offline.
+	offlineSince map[string]map[string]time.Time
+	// Format: dryRun[serviceID] = dead, as if the changes were made.
+	dryRun map[string]bool
+}
+
+func (t *Tagger) ReadEvents(ctx context.Context, inputCh <-chan scanner.Event, outputCh chan<- scanner.Event) error {
+	t.offlineSince = make(map[string]map[string]time.Time)
+	t.dryRun = make(map[string]bool)
+	defer func() {
+		if outputCh != nil {
+			close(outputCh)
+		}
+	}()
+
+	for {
+		select {
+		case event, more := <-inputCh:
+			if !more {
+				return nil
+			}
+
+			switch e := event.(type) {
+			case scanner.WorkerStarted:
+				t.urls(e.ServiceID)[e.URL] = time.Time{}
+
+			case scanner.WorkerStopped:
+				delete(t.urls(e.ServiceID), e.URL)
+
+			case scanner.ProcessStopped:
+				delete(t.offlineSince, e.ServiceID)
+
+			case scanner.ScanEvent:
+				if e.Stopped() {
+					break
+				}
+				t.update(e)
+			}
+
+			if outputCh != nil {
+				outputCh <- event
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (t *Tagger) urls(serviceID string) map[string]time.Time {
+	if _, ok := t.offlineSince[serviceID]; !ok {
+		t.offlineSince[serviceID] = make(map[string]time.Time)
+	}
+	return t.offlineSince[serviceID]
+}
+
+func (t *Tagger) update(e scanner.ScanEvent) {
+	urls := t.urls(e.ServiceID)
+
+	if e.Status == scanner.StatusOnline {
+		urls[e.URL] = time.Time{}
+
+		dead, err := t.isDead(e.ServiceID)
+		if err != nil {
+			t.logf("failed to check service `%s`: %s", e.ServiceID, err)
+			return
+		}
+		if dead {
+			t.setDead(e.ServiceID, false, "URL "+e.URL+" is online")
+		}
+		return
+	}
+
+	now := time.Now()
+	if urls[e.URL].IsZero() {
+		urls[e.URL] = t.historyOfflineSince(e.URL, now)
+	}
+
+	// All URLs of the service, including those not scanned yet, must be known
+	// to be offline. The service is offline since its last URL went offline.
+	service, err := t.ot.GetService(e.ServiceID)
+	if err != nil {
+		t.logf("failed to check service `%s`: %s", e.ServiceID, err)
+		return
+	}
+	serviceURLs := make(map[string]struct{}, len(urls)+len(service.URLs))
+	for url := range urls {
+		serviceURLs[url] = struct{}{}
+	}
+	for _, url := range service.URLs {
+		if url, err := scanner.Normalize(url); err == nil {
+			serviceURLs[url] = struct{}{}
+		}
+	}
+	since := time.Time{}
+	for url := range serviceURLs {
+		offlineSince := urls[url]
+		if offlineSince.IsZero() {
+			return
+		}
+		if offlineSince.After(since) {
+			since = offlineSince
+		}
+	}
+
+	threshold, err := t.threshold(e.ServiceID)
+	if err != nil {
+		t.logf("failed to check service `%s`: %s", e.ServiceID, err)
+		return
+	}
+	offline := now.Sub(since)
+	if offline < threshold {
+		return
+	}
+
+	dead, err := t.isDead(e.ServiceID)
+	if err != nil {
+		t.logf("failed to check service `%s`: %s", e.ServiceID, err)
+		return
+	}
+	if !dead {
+		t.setDead(e.ServiceID, true, "all URLs offline for "+offline.Round(time.Second).String())
+	}
+}
+
+// historyOfflineSince returns when `url` went offline according to the history,
+// or `now` if it's not known.
+func (t *Tagger) historyOfflineSince(url string, now time.Time) time.Time {
+	if t.config.History == nil {
+		return now
+	}
+	transitions, err := t.config.History.Query(url, time.Time{}, now)
+	if err != nil {
+		t.logf("failed to query history of URL %s: %s", url, err)
+		return now
+	}
+	if n := len(transitions); n > 0 && transitions[n-1].Status == scanner.StatusOffline {
+		return transitions[n-1].Time
+	}
+	return now
+}
+
+// isDead returns true if service `serviceID` is tagged dead.
+func (t *Tagger) isDead(serviceID string) (bool, error) {
+	if dead, ok := t.dryRun[serviceID]; ok {
+		return dead, nil
+	}
+	serviceIDs, err := t.ot.ListServicesWithTag(scanner.DeadTag)
+	if err != nil {
+		if _, ok := err.(*oniontree.ErrTagNotExists); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return contains(serviceIDs, serviceID), nil
+}
+
+// threshold returns how long service `serviceID` must be offline to be tagged dead.
+func (t *Tagger) threshold(serviceID string) (time.Duration, error) {
+	threshold := t.config.Threshold
+	matched := false
+	for tag, d := range t.config.TagThresholds {
+		serviceIDs, err := t.ot.ListServicesWithTagRecursive(tag)
+		if err != nil {
+			if _, ok := err.(*oniontree.ErrTagNotExists); ok {
+				continue
+			}
+			return 0, err
+		}
+		if !contains(serviceIDs, serviceID) {
+			continue
+		}
+		if !matched || d > threshold {
+			threshold = d
+			matched = true
+		}
+	}
+	return threshold, nil
+}
+
+func (t *Tagger) setDead(serviceID string, dead bool, reason string) {
+	action, result, update := "tag", "tagged", t.ot.TagService
+	if !dead {
+		action, result, update = "untag", "untagged", t.ot.UntagService
+	}
+
+	if t.config.DryRun {
+		t.dryRun[serviceID] = dead
+		t.logf("dry run: %s service `%s` dead: %s", action, serviceID, reason)
+		return
+	}
+
+	if err := update(serviceID, []oniontree.Tag{scanner.DeadTag}); err != nil {
+		t.logf("failed to %s service `%s` dead: %s", action, serviceID, err)
+		return
+	}
+	t.logf("%s service `%s` dead: %s", result, serviceID, reason)
+}
+
+func (t *Tagger) logf(format string, v ...interface{}) {
+	if t.config.Logger != nil {
+		t.config.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// contains returns true if sorted `ids` contain `id`.
+func contains(ids []string, id string) bool {
+	i := sort.SearchStrings(ids, id)
+	return i < len(ids) && ids[i] == id
+}
+
+func New(ot *oniontree.OnionTree, cfg Config) *Tagger {
+	return &Tagger{
+		ot:     ot,
+		config: cfg,
+	}
+}
@@ -0,0 +1,252 @@
+package evtdead_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/evtdead"
+	"github.com/oniontree-org/go-oniontree/scanner/evthistory"
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	serviceID = "oniontree"
+	url       = "http://onions53ehmf4q75.onion"
+)
+
+func copyOnionTree(t *testing.T) (*oniontree.OnionTree, func() error) {
+	tmpDir, err := ioutil.TempDir("", "go-oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copy.Copy("../../testdata/oniontree", tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	return oniontree.New(tmpDir), func() error {
+		return os.RemoveAll(tmpDir)
+	}
+}
+
+// startTagger starts `tagger` and returns a function emitting an event
+// and waiting until it's processed.
+func startTagger(t *testing.T, ctx context.Context, tagger *evtdead.Tagger) func(scanner.Event) {
+	eventCh := make(chan scanner.Event)
+	outputCh := make(chan scanner.Event)
+
+	go func() {
+		if err := tagger.ReadEvents(ctx, eventCh, outputCh); err != nil {
+			log.Printf("%s\n", err)
+		}
+	}()
+
+	return func(event scanner.Event) {
+		eventCh <- event
+		select {
+		case <-outputCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func isDead(t *testing.T, ot *oniontree.OnionTree) bool {
+	serviceIDs, err := ot.ListServicesWithTag(scanner.DeadTag)
+	if err != nil {
+		if _, ok := err.(*oniontree.ErrTagNotExists); ok {
+			return false
+		}
+		t.Fatal(err)
+	}
+	for i := range serviceIDs {
+		if serviceIDs[i] == serviceID {
+			return true
+		}
+	}
+	return false
+}
+
+func offline(url string) scanner.ScanEvent {
+	return scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       url,
+		ServiceID: serviceID,
+		Error:     errors.New("host is offline"),
+	}
+}
+
+func online(url string) scanner.ScanEvent {
+	return scanner.ScanEvent{
+		Status:    scanner.StatusOnline,
+		URL:       url,
+		ServiceID: serviceID,
+	}
+}
+
+func TestTagger_ReadEvents(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logs := &bytes.Buffer{}
+	emitEvent := startTagger(t, ctx, evtdead.New(ot, evtdead.Config{
+		Threshold: 200 * time.Millisecond,
+		Logger:    log.New(logs, "", 0),
+	}))
+
+	const url2 = "http://onions52ehmf4q75.onion"
+
+	emitEvent(scanner.WorkerStarted{URL: url, ServiceID: serviceID})
+	emitEvent(scanner.WorkerStarted{URL: url2, ServiceID: serviceID})
+	emitEvent(offline(url))
+	time.Sleep(300 * time.Millisecond)
+
+	// The other URL is not known to be offline.
+	emitEvent(offline(url))
+	assert.False(t, isDead(t, ot))
+
+	emitEvent(offline(url2))
+	assert.False(t, isDead(t, ot), "the threshold counts from the last URL going offline")
+
+	time.Sleep(300 * time.Millisecond)
+	emitEvent(offline(url))
+	assert.True(t, isDead(t, ot))
+
+	// Results of stopped workers are ignored.
+	emitEvent(scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       url,
+		ServiceID: serviceID,
+		Error:     context.Canceled,
+	})
+	assert.True(t, isDead(t, ot))
+
+	emitEvent(online(url2))
+	assert.False(t, isDead(t, ot))
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.True(t, strings.HasPrefix(lines[0], "tagged service `oniontree` dead: all URLs offline for "), lines[0])
+		assert.Equal(t, "untagged service `oniontree` dead: URL "+url2+" is online", lines[1])
+	}
+}
+
+func TestTagger_ReadEventsTagThresholds(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	emitEvent := startTagger(t, ctx, evtdead.New(ot, evtdead.Config{
+		Threshold: 0,
+		TagThresholds: map[oniontree.Tag]time.Duration{
+			"link_list": time.Hour,
+			"unknown":   0,
+		},
+		Logger: log.New(ioutil.Discard, "", 0),
+	}))
+
+	emitEvent(offline(url))
+	assert.False(t, isDead(t, ot))
+
+	if err := ot.UntagService(serviceID, []oniontree.Tag{"link_list"}); err != nil {
+		t.Fatal(err)
+	}
+	emitEvent(offline(url))
+	assert.True(t, isDead(t, ot))
+}
+
+func TestTagger_ReadEventsDryRun(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logs := &bytes.Buffer{}
+	emitEvent := startTagger(t, ctx, evtdead.New(ot, evtdead.Config{
+		DryRun: true,
+		Logger: log.New(logs, "", 0),
+	}))
+
+	emitEvent(offline(url))
+	emitEvent(offline(url))
+	assert.False(t, isDead(t, ot))
+
+	emitEvent(online(url))
+	emitEvent(online(url))
+
+	assert.Equal(t, "dry run: tag service `oniontree` dead: all URLs offline for 0s\n"+
+		"dry run: untag service `oniontree` dead: URL "+url+" is online\n", logs.String())
+}
+
+// history returns transitions of a single URL.
+type history []scanner.Transition
+
+func (h history) Query(url string, from, to time.Time) ([]scanner.Transition, error) {
+	return h, nil
+}
+
+var _ evtdead.History = (*evthistory.History)(nil)
+
+func TestTagger_ReadEventsHistory(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	cfg := evtdead.DefaultConfig
+	cfg.Logger = log.New(ioutil.Discard, "", 0)
+	cfg.History = history{
+		{Time: now.Add(-20 * 24 * time.Hour), ServiceID: serviceID, URL: url, Status: scanner.StatusOnline},
+		{Time: now.Add(-10 * 24 * time.Hour), ServiceID: serviceID, URL: url, Status: scanner.StatusOffline},
+	}
+
+	// The URL has been offline for longer than the threshold before the tagger started.
+	emitEvent := startTagger(t, ctx, evtdead.New(ot, cfg))
+	emitEvent(offline(url))
+	assert.True(t, isDead(t, ot))
+}
+
+func TestTagger_ReadEventsUnscannedURLs(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	const url2 = "http://onions52ehmf4q75.onion"
+
+	service, err := ot.GetService(serviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.AddURLs([]string{url2})
+	if err := ot.UpdateService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	emitEvent := startTagger(t, ctx, evtdead.New(ot, evtdead.Config{
+		Logger: log.New(ioutil.Discard, "", 0),
+	}))
+
+	// No worker events, the other URL is known only from the service file.
+	emitEvent(offline(url))
+	assert.False(t, isDead(t, ot))
+
+	emitEvent(offline(url2))
+	assert.True(t, isDead(t, ot))
+}
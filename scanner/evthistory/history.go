@@ -0,0 +1,227 @@
+// Package evthistory records status transitions of URLs reported by the scanner
+// to an on-disk bbolt database.
+package evthistory
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// record is a transition as stored in the database.
+type record struct {
+	ServiceID string         `json:"service_id"`
+	Status    scanner.Status `json:"status"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Database layout: bucket "urls" holds a bucket per URL, which maps
+// big-endian UnixNano timestamps to JSON encoded records.
+var urlsBucket = []byte("urls")
+
+type History struct {
+	db *bolt.DB
+	// Format: last[url] = status
+	last map[string]scanner.Status
+}
+
+// ReadEvents records transitions reported by ScanEvents. It returns on the first
+// error writing to the database.
+func (h *History) ReadEvents(ctx context.Context, inputCh <-chan scanner.Event, outputCh chan<- scanner.Event) error {
+	h.last = make(map[string]scanner.Status)
+	defer func() {
+		if outputCh != nil {
+			close(outputCh)
+		}
+	}()
+
+	for {
+		select {
+		case event, more := <-inputCh:
+			if !more {
+				return nil
+			}
+
+			switch e := event.(type) {
+			case scanner.ScanEvent:
+				if e.Stopped() {
+					break
+				}
+				if err := h.record(e); err != nil {
+					return err
+				}
+			}
+
+			if outputCh != nil {
+				outputCh <- event
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// record stores the status reported by `e` if it differs from the last one.
+func (h *History) record(e scanner.ScanEvent) error {
+	if status, ok := h.last[e.URL]; ok && status == e.Status {
+		return nil
+	}
+
+	t := scanner.Transition{
+		Time:      time.Now(),
+		ServiceID: e.ServiceID,
+		URL:       e.URL,
+		Status:    e.Status,
+	}
+	if e.Error != nil {
+		t.Error = e.Error.Error()
+	}
+
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(urlsBucket).CreateBucketIfNotExists([]byte(e.URL))
+		if err != nil {
+			return err
+		}
+
+		// The status may be known from the previous run.
+		k, v := b.Cursor().Last()
+		if k != nil {
+			last := record{}
+			if err := json.Unmarshal(v, &last); err != nil {
+				return err
+			}
+			if last.Status == e.Status {
+				return nil
+			}
+			// Keep the keys unique and ordered even if the clock goes backwards.
+			if prev := decodeTime(k); !t.Time.After(prev) {
+				t.Time = prev.Add(time.Nanosecond)
+			}
+		}
+
+		v, err = json.Marshal(record{
+			ServiceID: t.ServiceID,
+			Status:    t.Status,
+			Error:     t.Error,
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put(encodeTime(t.Time), v)
+	})
+	if err != nil {
+		return err
+	}
+	h.last[e.URL] = e.Status
+	return nil
+}
+
+// Query returns transitions of `url` that happened in time range [from, to),
+// ordered by time.
+func (h *History) Query(url string, from, to time.Time) ([]scanner.Transition, error) {
+	transitions := []scanner.Transition{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket).Bucket([]byte(url))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(encodeTime(from)); k != nil; k, v = c.Next() {
+			ts := decodeTime(k)
+			if !ts.Before(to) {
+				break
+			}
+			r := record{}
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			transitions = append(transitions, scanner.Transition{
+				Time:      ts,
+				ServiceID: r.ServiceID,
+				URL:       url,
+				Status:    r.Status,
+				Error:     r.Error,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// Compact deletes transitions that happened before `before`, except
+// the last one of each URL, so that the status at `before` stays known.
+// It returns number of deleted transitions.
+func (h *History) Compact(before time.Time) (int, error) {
+	deleted := 0
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(url, _ []byte) error {
+			b := tx.Bucket(urlsBucket).Bucket(url)
+
+			keys := [][]byte{}
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && decodeTime(k).Before(before); k, _ = c.Next() {
+				keys = append(keys, k)
+			}
+			if len(keys) < 2 {
+				return nil
+			}
+			for _, k := range keys[:len(keys)-1] {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+				deleted++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Close closes the database.
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// encodeTime encodes `t` as a database key. Times before the Unix epoch,
+// including the zero time, are encoded as the epoch.
+func encodeTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	if t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	}
+	return b
+}
+
+func decodeTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+// Open opens the history database at `path`, creating it if it doesn't exist.
+func Open(path string) (*History, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(urlsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &History{
+		db: db,
+	}, nil
+}
@@ -0,0 +1,178 @@
+package evthistory_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/evthistory"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+const (
+	serviceID = "oniontree"
+	url       = "http://onions53ehmf4q75.onion"
+)
+
+var errOffline = errors.New("host is offline")
+
+func newTempDir(t *testing.T) (string, func() error) {
+	tmpDir, err := ioutil.TempDir("", "go-oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpDir, func() error {
+		return os.RemoveAll(tmpDir)
+	}
+}
+
+func openHistory(t *testing.T, pth string) *evthistory.History {
+	h, err := evthistory.Open(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// readEvents passes `events` to `h` and waits until they're processed.
+func readEvents(t *testing.T, h *evthistory.History, events ...scanner.Event) {
+	eventCh := make(chan scanner.Event)
+	outputCh := make(chan scanner.Event)
+
+	go func() {
+		if err := h.ReadEvents(context.Background(), eventCh, outputCh); err != nil {
+			log.Printf("%s\n", err)
+		}
+	}()
+
+	for _, event := range events {
+		eventCh <- event
+		<-outputCh
+	}
+	close(eventCh)
+	for range outputCh {
+	}
+}
+
+func scanEvent(status scanner.Status, err error) scanner.ScanEvent {
+	return scanner.ScanEvent{
+		Status:    status,
+		URL:       url,
+		ServiceID: serviceID,
+		Error:     err,
+	}
+}
+
+func statuses(transitions []scanner.Transition) []scanner.Status {
+	s := make([]scanner.Status, len(transitions))
+	for i := range transitions {
+		s[i] = transitions[i].Status
+	}
+	return s
+}
+
+func TestHistory_ReadEvents(t *testing.T) {
+	dir, cleanup := newTempDir(t)
+	defer cleanup()
+	pth := path.Join(dir, "history.db")
+
+	start := time.Now()
+
+	h := openHistory(t, pth)
+	readEvents(t, h,
+		scanEvent(scanner.StatusOnline, nil),
+		scanEvent(scanner.StatusOnline, nil),
+		scanEvent(scanner.StatusOffline, errOffline),
+		// Workers report the service offline when stopped.
+		scanEvent(scanner.StatusOffline, context.Canceled),
+	)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last status is known after restart.
+	h = openHistory(t, pth)
+	defer h.Close()
+	readEvents(t, h,
+		scanEvent(scanner.StatusOffline, errOffline),
+		scanEvent(scanner.StatusOnline, nil),
+	)
+
+	transitions, err := h.Query(url, start, time.Now())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []scanner.Status{
+		scanner.StatusOnline,
+		scanner.StatusOffline,
+		scanner.StatusOnline,
+	}, statuses(transitions))
+
+	assert.Equal(t, serviceID, transitions[1].ServiceID)
+	assert.Equal(t, url, transitions[1].URL)
+	assert.Equal(t, errOffline.Error(), transitions[1].Error)
+	for i := 1; i < len(transitions); i++ {
+		assert.True(t, transitions[i].Time.After(transitions[i-1].Time))
+	}
+}
+
+func TestHistory_Query(t *testing.T) {
+	dir, cleanup := newTempDir(t)
+	defer cleanup()
+
+	h := openHistory(t, path.Join(dir, "history.db"))
+	defer h.Close()
+
+	readEvents(t, h, scanEvent(scanner.StatusOnline, nil))
+	time.Sleep(10 * time.Millisecond)
+	middle := time.Now()
+	readEvents(t, h, scanEvent(scanner.StatusOffline, errOffline))
+
+	transitions, err := h.Query(url, time.Time{}, middle)
+	assert.NoError(t, err)
+	assert.Equal(t, []scanner.Status{scanner.StatusOnline}, statuses(transitions))
+
+	transitions, err = h.Query(url, middle, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []scanner.Status{scanner.StatusOffline}, statuses(transitions))
+
+	transitions, err = h.Query("http://unknown.onion", time.Time{}, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, transitions)
+}
+
+func TestHistory_Compact(t *testing.T) {
+	dir, cleanup := newTempDir(t)
+	defer cleanup()
+
+	h := openHistory(t, path.Join(dir, "history.db"))
+	defer h.Close()
+
+	readEvents(t, h,
+		scanEvent(scanner.StatusOnline, nil),
+		scanEvent(scanner.StatusOffline, errOffline),
+		scanEvent(scanner.StatusOnline, nil),
+	)
+	time.Sleep(10 * time.Millisecond)
+	before := time.Now()
+	readEvents(t, h, scanEvent(scanner.StatusOffline, errOffline))
+
+	deleted, err := h.Compact(before)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 2, deleted)
+
+	// The status at `before` is kept.
+	transitions, err := h.Query(url, time.Time{}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []scanner.Status{
+		scanner.StatusOnline,
+		scanner.StatusOffline,
+	}, statuses(transitions))
+}
@@ -2,12 +2,23 @@ package evtmetrics
 
 import (
 	"context"
+	"fmt"
 	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/evtstats"
 	"github.com/prometheus/client_golang/prometheus"
+	"time"
 )
 
 type Metrics struct {
-	gauge *prometheus.GaugeVec
+	gauge       *prometheus.GaugeVec
+	connectTime *prometheus.HistogramVec
+	ttfb        *prometheus.HistogramVec
+	attempts    *prometheus.HistogramVec
+
+	stats         *evtstats.Stats
+	uptime        *prometheus.Desc
+	mtbf          *prometheus.Desc
+	longestOutage *prometheus.Desc
 }
 
 func (m *Metrics) ReadEvents(ctx context.Context, inputCh <-chan scanner.Event, outputCh chan<- scanner.Event) error {
@@ -31,6 +42,17 @@ func (m *Metrics) ReadEvents(ctx context.Context, inputCh <-chan scanner.Event,
 					e.URL,
 					e.Directory,
 				).Set(float64(e.Status))
+
+				// Timings are not known if the connection failed.
+				if e.ConnectTime > 0 {
+					m.connectTime.WithLabelValues(e.ServiceID).Observe(e.ConnectTime.Seconds())
+				}
+				if e.TTFB > 0 {
+					m.ttfb.WithLabelValues(e.ServiceID).Observe(e.TTFB.Seconds())
+				}
+				if e.Attempts > 0 {
+					m.attempts.WithLabelValues(e.ServiceID).Observe(float64(e.Attempts))
+				}
 			}
 
 			if outputCh != nil {
@@ -45,18 +67,100 @@ func (m *Metrics) ReadEvents(ctx context.Context, inputCh <-chan scanner.Event,
 
 func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
 	m.gauge.Describe(ch)
+	m.connectTime.Describe(ch)
+	m.ttfb.Describe(ch)
+	m.attempts.Describe(ch)
+	if m.stats != nil {
+		ch <- m.uptime
+		ch <- m.mtbf
+		ch <- m.longestOutage
+	}
 }
 
 func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 	m.gauge.Collect(ch)
+	m.connectTime.Collect(ch)
+	m.ttfb.Collect(ch)
+	m.attempts.Collect(ch)
+	if m.stats != nil {
+		m.collectStats(ch)
+	}
+}
+
+// collectStats computes availability statistics at the time of collection.
+// Label `url` is empty for statistics of a service.
+func (m *Metrics) collectStats(ch chan<- prometheus.Metric) {
+	for _, window := range m.stats.Windows() {
+		label := windowLabel(window)
+		for _, a := range m.stats.All(window) {
+			if a.Observed == 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.uptime, prometheus.GaugeValue, a.Uptime, a.ServiceID, a.URL, label)
+			ch <- prometheus.MustNewConstMetric(m.longestOutage, prometheus.GaugeValue, a.LongestOutage.Seconds(), a.ServiceID, a.URL, label)
+			// MTBF is not defined without a failure.
+			if a.Failures > 0 {
+				ch <- prometheus.MustNewConstMetric(m.mtbf, prometheus.GaugeValue, a.MTBF.Seconds(), a.ServiceID, a.URL, label)
+			}
+		}
+	}
+}
+
+// windowLabel formats `window` in days or hours if possible, e.g. "7d" or "12h".
+func windowLabel(window time.Duration) string {
+	switch {
+	case window%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+	return window.String()
 }
 
 func (m *Metrics) Get() *prometheus.GaugeVec {
 	return m.gauge
 }
 
+// ConnectTime returns a histogram of connection times in seconds.
+func (m *Metrics) ConnectTime() *prometheus.HistogramVec {
+	return m.connectTime
+}
+
+// TTFB returns a histogram of times to the first byte of HTTP responses in seconds.
+func (m *Metrics) TTFB() *prometheus.HistogramVec {
+	return m.ttfb
+}
+
+// Attempts returns a histogram of numbers of attempts made before the status was determined.
+func (m *Metrics) Attempts() *prometheus.HistogramVec {
+	return m.attempts
+}
+
 func New() *Metrics {
+	return NewWithStats(nil)
+}
+
+// NewWithStats returns Metrics exporting also availability statistics computed by `stats`.
+// Events must be passed to `stats` separately.
+func NewWithStats(stats *evtstats.Stats) *Metrics {
+	labels := []string{"service_id", "url", "window"}
 	return &Metrics{
+		stats: stats,
+		uptime: prometheus.NewDesc(
+			"scanner_uptime_ratio",
+			"Ratio of time online to time with a known status.",
+			labels, nil,
+		),
+		mtbf: prometheus.NewDesc(
+			"scanner_mtbf_seconds",
+			"Mean time between failures.",
+			labels, nil,
+		),
+		longestOutage: prometheus.NewDesc(
+			"scanner_longest_outage_seconds",
+			"Longest continuous time offline.",
+			labels, nil,
+		),
 		gauge: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "scanner_event_info",
@@ -64,5 +168,30 @@ func New() *Metrics {
 			},
 			[]string{"service_id", "url", "directory"},
 		),
+		connectTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "scanner_connect_time_seconds",
+				Help: "Time it took to establish the connection.",
+				// Connections over Tor take from hundreds of milliseconds to tens of seconds.
+				Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+			},
+			[]string{"service_id"},
+		),
+		ttfb: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "scanner_ttfb_seconds",
+				Help:    "Time from sending the HTTP request to receiving the first byte of the response.",
+				Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+			},
+			[]string{"service_id"},
+		),
+		attempts: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "scanner_attempts",
+				Help:    "Number of attempts made before the status was determined.",
+				Buckets: prometheus.LinearBuckets(1, 1, 5),
+			},
+			[]string{"service_id"},
+		),
 	}
 }
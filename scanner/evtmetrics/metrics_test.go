@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/oniontree-org/go-oniontree/scanner"
 	"github.com/oniontree-org/go-oniontree/scanner/evtmetrics"
+	"github.com/oniontree-org/go-oniontree/scanner/evtstats"
+	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"log"
@@ -119,3 +121,107 @@ func TestMetrics_ReadEvents(t *testing.T) {
 		<-exitCh
 	}
 }
+
+func TestMetrics_ReadEventsTimings(t *testing.T) {
+	eventCh := make(chan scanner.Event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	metrics := evtmetrics.New()
+	exitCh := make(chan struct{})
+
+	go func() {
+		if err := metrics.ReadEvents(ctx, eventCh, nil); err != nil {
+			log.Printf("%s\n", err)
+		}
+		close(exitCh)
+	}()
+
+	serviceID := "oniontree"
+	eventCh <- scanner.ScanEvent{
+		Status:      scanner.StatusOnline,
+		URL:         "http://onions53ehmf4q75.onion",
+		ServiceID:   serviceID,
+		ConnectTime: 1500 * time.Millisecond,
+		TTFB:        300 * time.Millisecond,
+		Attempts:    2,
+	}
+	// Timings of a failed connection are not observed.
+	eventCh <- scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       "http://onions53ehmf4q75.onion",
+		ServiceID: serviceID,
+		Attempts:  3,
+	}
+	close(eventCh)
+	<-exitCh
+
+	histogram := func(vec *prometheus.HistogramVec) *io_prometheus_client.Histogram {
+		observer, err := vec.GetMetricWithLabelValues(serviceID)
+		if !assert.NoError(t, err) {
+			t.Fatal(err)
+		}
+		metric := io_prometheus_client.Metric{}
+		if err := observer.(prometheus.Metric).Write(&metric); !assert.NoError(t, err) {
+			t.Fatal(err)
+		}
+		return metric.GetHistogram()
+	}
+
+	connectTime := histogram(metrics.ConnectTime())
+	assert.Equal(t, uint64(1), connectTime.GetSampleCount())
+	assert.Equal(t, 1.5, connectTime.GetSampleSum())
+
+	ttfb := histogram(metrics.TTFB())
+	assert.Equal(t, uint64(1), ttfb.GetSampleCount())
+	assert.Equal(t, 0.3, ttfb.GetSampleSum())
+
+	attempts := histogram(metrics.Attempts())
+	assert.Equal(t, uint64(2), attempts.GetSampleCount())
+	assert.Equal(t, float64(5), attempts.GetSampleSum())
+}
+
+func TestMetrics_CollectStats(t *testing.T) {
+	stats := evtstats.New(evtstats.Config{
+		Windows: []time.Duration{24 * time.Hour},
+	})
+	start := time.Now().Add(-4 * time.Hour)
+	stats.Load([]scanner.Transition{
+		{Time: start, ServiceID: "oniontree", URL: "http://onions53ehmf4q75.onion", Status: scanner.StatusOnline},
+		{Time: start.Add(3 * time.Hour), ServiceID: "oniontree", URL: "http://onions53ehmf4q75.onion", Status: scanner.StatusOffline},
+	})
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(evtmetrics.NewWithStats(stats)); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gauges := map[string]map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["window"] != "1d" {
+				t.Fatalf("unexpected window `%s`", labels["window"])
+			}
+			if _, ok := gauges[family.GetName()]; !ok {
+				gauges[family.GetName()] = map[string]float64{}
+			}
+			gauges[family.GetName()][labels["url"]] = metric.GetGauge().GetValue()
+		}
+	}
+
+	// Both the URL and the service, which has an empty URL.
+	for _, url := range []string{"http://onions53ehmf4q75.onion", ""} {
+		assert.InDelta(t, 0.75, gauges["scanner_uptime_ratio"][url], 0.001)
+		assert.InDelta(t, 3*time.Hour.Seconds(), gauges["scanner_mtbf_seconds"][url], 1)
+		assert.InDelta(t, time.Hour.Seconds(), gauges["scanner_longest_outage_seconds"][url], 1)
+	}
+}
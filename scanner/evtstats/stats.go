@@ -0,0 +1,330 @@
+// Package evtstats computes uptime and availability statistics of URLs
+// and services from scanner events.
+package evtstats
+
+import (
+	"context"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Windows are durations of time windows the statistics are computed over.
+	Windows []time.Duration
+}
+
+var DefaultConfig = Config{
+	Windows: []time.Duration{
+		24 * time.Hour,
+		7 * 24 * time.Hour,
+		30 * 24 * time.Hour,
+	},
+}
+
+// Availability holds statistics of a URL, or of a service if URL is empty,
+// over a time window. Only the part of the window with a known status is
+// taken into account.
+type Availability struct {
+	ServiceID string
+	URL       string
+	// Observed is time with a known status.
+	Observed time.Duration
+	// Uptime is a ratio of time online to Observed.
+	Uptime float64
+	// Failures is a number of transitions from online to offline.
+	Failures int
+	// MTBF is mean time between failures, i.e. time online divided by Failures.
+	// It's zero if no failure occurred.
+	MTBF time.Duration
+	// LongestOutage is the longest continuous time offline.
+	LongestOutage time.Duration
+}
+
+type Stats struct {
+	sync.RWMutex
+	config Config
+	// Format: transitions[url] = transitions ordered by time
+	transitions map[string][]scanner.Transition
+	// Format: services[serviceID][url]
+	services map[string]map[string]struct{}
+}
+
+// ReadEvents records status transitions reported by ScanEvents.
+func (s *Stats) ReadEvents(ctx context.Context, inputCh <-chan scanner.Event, outputCh chan<- scanner.Event) error {
+	defer func() {
+		if outputCh != nil {
+			close(outputCh)
+		}
+	}()
+
+	for {
+		select {
+		case event, more := <-inputCh:
+			if !more {
+				return nil
+			}
+
+			switch e := event.(type) {
+			case scanner.ScanEvent:
+				if e.Stopped() {
+					break
+				}
+				s.Load([]scanner.Transition{{
+					Time:      time.Now(),
+					ServiceID: e.ServiceID,
+					URL:       e.URL,
+					Status:    e.Status,
+				}})
+
+			case scanner.WorkerStopped:
+				s.deleteURL(e.ServiceID, e.URL)
+			}
+
+			if outputCh != nil {
+				outputCh <- event
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Load records `transitions`, e.g. queried from evthistory.History. Transitions
+// of each URL must be ordered by time and newer than those already recorded.
+func (s *Stats) Load(transitions []scanner.Transition) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	for _, t := range transitions {
+		if _, ok := s.services[t.ServiceID]; !ok {
+			s.services[t.ServiceID] = make(map[string]struct{})
+		}
+		s.services[t.ServiceID][t.URL] = struct{}{}
+
+		urlTransitions := s.transitions[t.URL]
+		if n := len(urlTransitions); n > 0 && urlTransitions[n-1].Status == t.Status {
+			continue
+		}
+		s.transitions[t.URL] = prune(append(urlTransitions, t), now.Add(-s.maxWindow()))
+	}
+}
+
+// Windows returns durations of time windows the statistics are computed over.
+func (s *Stats) Windows() []time.Duration {
+	return s.config.Windows
+}
+
+// URL returns statistics of `url` over the last `window`.
+func (s *Stats) URL(url string, window time.Duration) (Availability, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	transitions, ok := s.transitions[url]
+	if !ok {
+		return Availability{}, false
+	}
+	now := time.Now()
+	a := Compute(transitions, now.Add(-window), now)
+	a.ServiceID = transitions[len(transitions)-1].ServiceID
+	a.URL = url
+	return a, true
+}
+
+// Service returns statistics of service `serviceID` over the last `window`.
+// The service is online if any of its URLs is online.
+func (s *Stats) Service(serviceID string, window time.Duration) (Availability, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.service(serviceID, window, time.Now())
+}
+
+// All returns statistics of all URLs and services over the last `window`,
+// ordered by service ID and URL.
+func (s *Stats) All(window time.Duration) []Availability {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now()
+	all := []Availability{}
+	for serviceID, urls := range s.services {
+		a, _ := s.service(serviceID, window, now)
+		all = append(all, a)
+
+		for url := range urls {
+			a := Compute(s.transitions[url], now.Add(-window), now)
+			a.ServiceID = serviceID
+			a.URL = url
+			all = append(all, a)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].ServiceID != all[j].ServiceID {
+			return all[i].ServiceID < all[j].ServiceID
+		}
+		return all[i].URL < all[j].URL
+	})
+	return all
+}
+
+func (s *Stats) service(serviceID string, window time.Duration, now time.Time) (Availability, bool) {
+	urls, ok := s.services[serviceID]
+	if !ok {
+		return Availability{}, false
+	}
+	byURL := make([][]scanner.Transition, 0, len(urls))
+	for url := range urls {
+		byURL = append(byURL, s.transitions[url])
+	}
+	a := Compute(merge(byURL), now.Add(-window), now)
+	a.ServiceID = serviceID
+	return a, true
+}
+
+func (s *Stats) deleteURL(serviceID, url string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.transitions, url)
+	if urls, ok := s.services[serviceID]; ok {
+		delete(urls, url)
+		if len(urls) == 0 {
+			delete(s.services, serviceID)
+		}
+	}
+}
+
+func (s *Stats) maxWindow() time.Duration {
+	max := time.Duration(0)
+	for _, window := range s.config.Windows {
+		if window > max {
+			max = window
+		}
+	}
+	return max
+}
+
+// Compute returns statistics over time range [from, to) from `transitions` of a single URL
+// ordered by time. The status at `from` is given by the last transition before it.
+// Fields ServiceID and URL are not set.
+func Compute(transitions []scanner.Transition, from, to time.Time) Availability {
+	a := Availability{}
+
+	var (
+		status scanner.Status
+		known  bool
+		since  = from
+		online time.Duration
+		outage time.Duration
+	)
+	advance := func(until time.Time) {
+		if !known {
+			return
+		}
+		d := until.Sub(since)
+		a.Observed += d
+		if status == scanner.StatusOnline {
+			online += d
+			return
+		}
+		outage += d
+		if outage > a.LongestOutage {
+			a.LongestOutage = outage
+		}
+	}
+
+	for _, t := range transitions {
+		if !t.Time.Before(to) {
+			break
+		}
+		if t.Time.After(from) {
+			advance(t.Time)
+			since = t.Time
+			if known && status == scanner.StatusOnline && t.Status == scanner.StatusOffline {
+				a.Failures++
+			}
+		}
+		if t.Status == scanner.StatusOnline {
+			outage = 0
+		}
+		status, known = t.Status, true
+	}
+	advance(to)
+
+	if a.Observed > 0 {
+		a.Uptime = float64(online) / float64(a.Observed)
+	}
+	if a.Failures > 0 {
+		a.MTBF = online / time.Duration(a.Failures)
+	}
+	return a
+}
+
+// merge returns transitions of a service given transitions of its URLs.
+// The service is online if any of its URLs with a known status is online.
+func merge(byURL [][]scanner.Transition) []scanner.Transition {
+	type urlTransition struct {
+		scanner.Transition
+		url int
+	}
+	all := []urlTransition{}
+	for i := range byURL {
+		for _, t := range byURL[i] {
+			all = append(all, urlTransition{t, i})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time.Before(all[j].Time)
+	})
+
+	merged := []scanner.Transition{}
+	statuses := make(map[int]scanner.Status, len(byURL))
+	for i := range all {
+		statuses[all[i].url] = all[i].Status
+		// Transitions happening at the same time are applied at once.
+		if i+1 < len(all) && all[i+1].Time.Equal(all[i].Time) {
+			continue
+		}
+
+		status := scanner.StatusOffline
+		for _, s := range statuses {
+			if s == scanner.StatusOnline {
+				status = scanner.StatusOnline
+				break
+			}
+		}
+		if n := len(merged); n > 0 && merged[n-1].Status == status {
+			continue
+		}
+		merged = append(merged, scanner.Transition{
+			Time:      all[i].Time,
+			ServiceID: all[i].ServiceID,
+			Status:    status,
+		})
+	}
+	return merged
+}
+
+// prune removes transitions before `before`, except the last one,
+// which gives the status at `before`.
+func prune(transitions []scanner.Transition, before time.Time) []scanner.Transition {
+	i := sort.Search(len(transitions), func(i int) bool {
+		return !transitions[i].Time.Before(before)
+	})
+	if i < 2 {
+		return transitions
+	}
+	return append([]scanner.Transition{}, transitions[i-1:]...)
+}
+
+func New(cfg Config) *Stats {
+	return &Stats{
+		config:      cfg,
+		transitions: make(map[string][]scanner.Transition),
+		services:    make(map[string]map[string]struct{}),
+	}
+}
@@ -0,0 +1,200 @@
+package evtstats_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/evtstats"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+	"time"
+)
+
+const (
+	serviceID = "oniontree"
+	url       = "http://onions53ehmf4q75.onion"
+	url2      = "http://onions52ehmf4q75.onion"
+)
+
+// transitions returns transitions of `url` starting at `start`, alternating
+// online and offline, each happening `offsets` hours after `start`.
+func transitions(url string, start time.Time, offsets ...float64) []scanner.Transition {
+	ts := make([]scanner.Transition, len(offsets))
+	for i := range offsets {
+		status := scanner.StatusOnline
+		if i%2 == 1 {
+			status = scanner.StatusOffline
+		}
+		ts[i] = scanner.Transition{
+			Time:      start.Add(time.Duration(offsets[i] * float64(time.Hour))),
+			ServiceID: serviceID,
+			URL:       url,
+			Status:    status,
+		}
+	}
+	return ts
+}
+
+func TestCompute(t *testing.T) {
+	start := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	hours := func(h float64) time.Time {
+		return start.Add(time.Duration(h * float64(time.Hour)))
+	}
+	ts := transitions(url, start, 0, 4, 5, 8, 10)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		expected evtstats.Availability
+	}{
+		{
+			name: "whole range",
+			from: hours(0),
+			to:   hours(12),
+			expected: evtstats.Availability{
+				Observed:      12 * time.Hour,
+				Uptime:        0.75,
+				Failures:      2,
+				MTBF:          270 * time.Minute,
+				LongestOutage: 2 * time.Hour,
+			},
+		},
+		{
+			name: "starts offline",
+			from: hours(4.5),
+			to:   hours(12),
+			expected: evtstats.Availability{
+				Observed:      450 * time.Minute,
+				Uptime:        5.0 / 7.5,
+				Failures:      1,
+				MTBF:          5 * time.Hour,
+				LongestOutage: 2 * time.Hour,
+			},
+		},
+		{
+			name: "unknown status",
+			from: hours(-2),
+			to:   hours(1),
+			expected: evtstats.Availability{
+				Observed: 1 * time.Hour,
+				Uptime:   1,
+			},
+		},
+		{
+			name:     "before all transitions",
+			from:     hours(-2),
+			to:       hours(-1),
+			expected: evtstats.Availability{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, evtstats.Compute(ts, test.from, test.to))
+		})
+	}
+}
+
+func TestStats_Load(t *testing.T) {
+	stats := evtstats.New(evtstats.DefaultConfig)
+
+	start := time.Now().Add(-12 * time.Hour)
+	// The service is offline only when both URLs are offline, from 4h to 5h.
+	stats.Load(transitions(url, start, 0, 2, 5))
+	stats.Load(transitions(url2, start, 0, 4, 8))
+
+	a, ok := stats.URL(url, 24*time.Hour)
+	if assert.True(t, ok) {
+		assert.Equal(t, serviceID, a.ServiceID)
+		assert.Equal(t, url, a.URL)
+		assert.InDelta(t, 9.0/12, a.Uptime, 0.001)
+		assert.Equal(t, 1, a.Failures)
+	}
+
+	a, ok = stats.Service(serviceID, 24*time.Hour)
+	if assert.True(t, ok) {
+		assert.Equal(t, serviceID, a.ServiceID)
+		assert.Empty(t, a.URL)
+		assert.InDelta(t, 11.0/12, a.Uptime, 0.001)
+		assert.Equal(t, 1, a.Failures)
+		assert.Equal(t, time.Hour, a.LongestOutage)
+	}
+
+	// The window is shorter than the history.
+	a, ok = stats.Service(serviceID, 6*time.Hour)
+	if assert.True(t, ok) {
+		assert.InDelta(t, 1, a.Uptime, 0.001)
+		assert.Equal(t, 0, a.Failures)
+	}
+
+	all := stats.All(24 * time.Hour)
+	if assert.Len(t, all, 3) {
+		assert.Equal(t, "", all[0].URL)
+		assert.Equal(t, url2, all[1].URL)
+		assert.Equal(t, url, all[2].URL)
+	}
+
+	_, ok = stats.URL("http://unknown.onion", 24*time.Hour)
+	assert.False(t, ok)
+	_, ok = stats.Service("unknown", 24*time.Hour)
+	assert.False(t, ok)
+}
+
+func TestStats_ReadEvents(t *testing.T) {
+	eventCh := make(chan scanner.Event)
+	outputCh := make(chan scanner.Event)
+	emitEvent := func(event scanner.Event) {
+		eventCh <- event
+		<-outputCh
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stats := evtstats.New(evtstats.DefaultConfig)
+	go func() {
+		if err := stats.ReadEvents(ctx, eventCh, outputCh); err != nil {
+			log.Printf("%s\n", err)
+		}
+	}()
+
+	emitEvent(scanner.ScanEvent{
+		Status:    scanner.StatusOnline,
+		URL:       url,
+		ServiceID: serviceID,
+	})
+	time.Sleep(50 * time.Millisecond)
+	emitEvent(scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       url,
+		ServiceID: serviceID,
+		Error:     errors.New("host is offline"),
+	})
+	emitEvent(scanner.ScanEvent{
+		Status:    scanner.StatusOnline,
+		URL:       url,
+		ServiceID: serviceID,
+	})
+	// Workers report the service offline when stopped.
+	emitEvent(scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       url,
+		ServiceID: serviceID,
+		Error:     context.Canceled,
+	})
+
+	a, ok := stats.URL(url, time.Hour)
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, a.Failures)
+		assert.True(t, a.Uptime > 0 && a.Uptime < 1, a.Uptime)
+	}
+
+	emitEvent(scanner.WorkerStopped{
+		URL:       url,
+		ServiceID: serviceID,
+	})
+	_, ok = stats.URL(url, time.Hour)
+	assert.False(t, ok)
+	_, ok = stats.Service(serviceID, time.Hour)
+	assert.False(t, ok)
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"context"
+	"golang.org/x/sync/semaphore"
+	"net"
+	"sync"
+)
+
+// connLimiter limits number of simultaneous outbound TCP connections,
+// in total and to a single host. A nil limiter doesn't limit anything.
+type connLimiter struct {
+	total      *semaphore.Weighted
+	perHostMax int64
+	// Format: hostMax[host] = limit
+	hostMax map[string]int64
+	mutex   sync.Mutex
+	// Format: hosts[host] = semaphore, kept while any connection waits for it or is open
+	hosts map[string]*hostSem
+}
+
+type hostSem struct {
+	sem  *semaphore.Weighted
+	refs int
+}
+
+// acquire waits for a free connection slot to `hostPort`. The slot must be freed
+// by calling the returned function.
+func (l *connLimiter) acquire(ctx context.Context, hostPort string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = hostPort
+	}
+
+	// Wait for the host first, so that connections to a busy host
+	// don't hold slots of the others.
+	hs := l.host(host)
+	if hs != nil {
+		if err := hs.sem.Acquire(ctx, 1); err != nil {
+			l.releaseHost(host)
+			return nil, err
+		}
+	}
+	if err := l.total.Acquire(ctx, 1); err != nil {
+		if hs != nil {
+			hs.sem.Release(1)
+			l.releaseHost(host)
+		}
+		return nil, err
+	}
+
+	return func() {
+		l.total.Release(1)
+		if hs != nil {
+			hs.sem.Release(1)
+			l.releaseHost(host)
+		}
+	}, nil
+}
+
+// host returns a referenced semaphore of `host`, or nil if connections
+// to the host are not limited.
+func (l *connLimiter) host(host string) *hostSem {
+	max, ok := l.hostMax[host]
+	if !ok {
+		max = l.perHostMax
+	}
+	if max < 1 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	hs, ok := l.hosts[host]
+	if !ok {
+		hs = &hostSem{sem: semaphore.NewWeighted(max)}
+		l.hosts[host] = hs
+	}
+	hs.refs++
+	return hs
+}
+
+func (l *connLimiter) releaseHost(host string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	hs, ok := l.hosts[host]
+	if !ok {
+		return
+	}
+	hs.refs--
+	if hs.refs == 0 {
+		delete(l.hosts, host)
+	}
+}
+
+func newConnLimiter(cfg ScannerConfig) *connLimiter {
+	return &connLimiter{
+		total:      semaphore.NewWeighted(cfg.WorkerTCPConnectionsMax),
+		perHostMax: cfg.WorkerTCPConnectionsPerHostMax,
+		hostMax:    cfg.HostTCPConnectionsMax,
+		hosts:      make(map[string]*hostSem),
+	}
+}
@@ -0,0 +1,140 @@
+package scanner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdingDialer holds each connection attempt for a while before it fails
+// and records the highest number of parallel attempts per host.
+type holdingDialer struct {
+	mutex sync.Mutex
+	// Format: open[host] = number of attempts in progress
+	open map[string]int
+	// Format: max[host] = highest number of parallel attempts
+	max map[string]int
+}
+
+func (d *holdingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	d.open[host]++
+	if d.open[host] > d.max[host] {
+		d.max[host] = d.open[host]
+	}
+	d.mutex.Unlock()
+
+	select {
+	case <-time.After(50 * time.Millisecond):
+	case <-ctx.Done():
+	}
+
+	d.mutex.Lock()
+	d.open[host]--
+	d.mutex.Unlock()
+	return nil, errors.New("connection refused")
+}
+
+func (d *holdingDialer) maxParallel(host string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.max[host]
+}
+
+func newHoldingDialer() *holdingDialer {
+	return &holdingDialer{
+		open: make(map[string]int),
+		max:  make(map[string]int),
+	}
+}
+
+// addMirrors adds `n` services with URLs of service oniontree.
+func addMirrors(t *testing.T, ot *oniontree.OnionTree, n int) {
+	for i := 0; i < n; i++ {
+		service := oniontree.NewService(fmt.Sprintf("mirror%d", i))
+		service.Name = "Mirror"
+		service.URLs = []string{
+			"http://onions53ehmf4q75.onion",
+			"https://onions53ehmf4q75.onion",
+		}
+		if err := ot.AddService(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanner_ScanOnceHostConnectionLimits(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addMirrors(t, ot, 3)
+
+	dialer := newHoldingDialer()
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = testWorkerConfig
+	cfg.WorkerConfig.PingRetryAttempts = 1
+	cfg.WorkerTCPConnectionsPerHostMax = 2
+
+	report, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Len(t, report.Offline(), 7)
+	assert.Equal(t, 2, dialer.maxParallel("onions53ehmf4q75.onion"))
+
+	dialer = newHoldingDialer()
+	cfg.Dialer = dialer
+	cfg.HostTCPConnectionsMax = map[string]int64{
+		"onions53ehmf4q75.onion": 1,
+	}
+
+	_, err = scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 1, dialer.maxParallel("onions53ehmf4q75.onion"))
+}
+
+func TestScanner_ScanOnceConnectionLimitPerScanner(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addMirrors(t, ot, 1)
+
+	dialer := newHoldingDialer()
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = testWorkerConfig
+	cfg.WorkerConfig.PingRetryAttempts = 1
+	cfg.WorkerTCPConnectionsMax = 1
+	cfg.WorkerTCPConnectionsPerHostMax = 0
+
+	// Scanners don't share their limits.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 2, dialer.maxParallel("onions53ehmf4q75.onion"))
+}
@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"reflect"
+)
+
+// Policy sets WorkerConfig of services with IDs `ServiceIDs`, or tagged
+// with any of `Tags` or their descendants.
+type Policy struct {
+	ServiceIDs []string
+	Tags       []oniontree.Tag
+	// WorkerConfig is used by workers of matching services. Zero fields
+	// are taken from ScannerConfig.WorkerConfig.
+	WorkerConfig WorkerConfig
+}
+
+// schedule maps services to worker configurations given by policies.
+type schedule struct {
+	defaults WorkerConfig
+	policies []Policy
+	// Format: services[i][serviceID] for policy i
+	services []map[string]struct{}
+}
+
+// workerConfig returns a configuration of workers of service `serviceID`.
+// The first matching policy applies.
+func (s *schedule) workerConfig(serviceID string) WorkerConfig {
+	for i := range s.policies {
+		if _, ok := s.services[i][serviceID]; ok {
+			return mergeWorkerConfig(s.policies[i].WorkerConfig, s.defaults)
+		}
+	}
+	return s.defaults
+}
+
+// load resolves tags of the policies to service IDs.
+func (s *schedule) load(ot *oniontree.OnionTree) error {
+	services := make([]map[string]struct{}, len(s.policies))
+	for i, policy := range s.policies {
+		services[i] = make(map[string]struct{}, len(policy.ServiceIDs))
+		for _, id := range policy.ServiceIDs {
+			services[i][id] = struct{}{}
+		}
+		for _, tag := range policy.Tags {
+			serviceIDs, err := ot.ListServicesWithTagRecursive(tag)
+			if err != nil {
+				if _, ok := err.(*oniontree.ErrTagNotExists); ok {
+					continue
+				}
+				return err
+			}
+			for _, id := range serviceIDs {
+				services[i][id] = struct{}{}
+			}
+		}
+	}
+	s.services = services
+	return nil
+}
+
+// hasTags returns true if any of the policies selects services by tags.
+func (s *schedule) hasTags() bool {
+	for i := range s.policies {
+		if len(s.policies[i].Tags) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newSchedule returns a schedule of policies given by `cfg` followed by
+// policies from the configuration of repository `ot`.
+func newSchedule(ot *oniontree.OnionTree, cfg ScannerConfig) (*schedule, error) {
+	otCfg, err := ot.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := append([]Policy{}, cfg.Policies...)
+	for _, p := range otCfg.Scanner.Policies {
+		var backoff Backoff
+		if p.RetryBackoff != "" {
+			backoff, err = ParseBackoff(p.RetryBackoff)
+			if err != nil {
+				return nil, err
+			}
+		}
+		policies = append(policies, Policy{
+			ServiceIDs: p.Services,
+			Tags:       p.Tags,
+			WorkerConfig: WorkerConfig{
+				PingInterval:      p.PingInterval,
+				PingTimeout:       p.PingTimeout,
+				PingPauseInterval: p.PingPauseInterval,
+				PingRetryInterval: p.PingRetryInterval,
+				PingRetryAttempts: p.PingRetryAttempts,
+				RetryBackoff:      backoff,
+				Jitter:            p.Jitter,
+				StartJitter:       p.StartJitter,
+			},
+		})
+	}
+
+	s := &schedule{
+		defaults: cfg.WorkerConfig,
+		policies: policies,
+	}
+	if err := s.load(ot); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// mergeWorkerConfig returns `cfg` with zero fields set from `defaults`.
+// Zero Jitter and StartJitter can't turn jitter off, negative values do.
+func mergeWorkerConfig(cfg, defaults WorkerConfig) WorkerConfig {
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = defaults.PingInterval
+	}
+	if cfg.PingTimeout == 0 {
+		cfg.PingTimeout = defaults.PingTimeout
+	}
+	if cfg.PingPauseInterval == 0 {
+		cfg.PingPauseInterval = defaults.PingPauseInterval
+	}
+	if cfg.PingRetryInterval == 0 {
+		cfg.PingRetryInterval = defaults.PingRetryInterval
+	}
+	if cfg.PingRetryAttempts == 0 {
+		cfg.PingRetryAttempts = defaults.PingRetryAttempts
+	}
+	if cfg.RetryBackoff == nil {
+		cfg.RetryBackoff = defaults.RetryBackoff
+	}
+	if cfg.Jitter == 0 {
+		cfg.Jitter = defaults.Jitter
+	}
+	if cfg.StartJitter == 0 {
+		cfg.StartJitter = defaults.StartJitter
+	}
+	if reflect.DeepEqual(cfg.Probe, ProbeConfig{}) {
+		cfg.Probe = defaults.Probe
+	}
+	return cfg
+}
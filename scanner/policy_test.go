@@ -0,0 +1,189 @@
+package scanner_test
+
+import (
+	"context"
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/scannertest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+)
+
+// startScannerWithPolicies starts a scanner of an online service with `policies`
+// and returns a channel with its events.
+func startScannerWithPolicies(t *testing.T, ctx context.Context, dir string, policies []scanner.Policy) <-chan scanner.Event {
+	dialer := scannertest.NewDialer()
+	dialer.SetOnline("onions53ehmf4q75.onion")
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = testWorkerConfig
+	cfg.Policies = policies
+
+	eventCh := make(chan scanner.Event)
+	go func() {
+		_ = scanner.NewScanner(cfg).Start(ctx, dir, eventCh)
+	}()
+	return eventCh
+}
+
+// drainEvents reads events for `d`.
+func drainEvents(eventCh <-chan scanner.Event, d time.Duration) {
+	timeout := time.After(d)
+	for {
+		select {
+		case <-eventCh:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// mustNoScanEvent fails if a ScanEvent arrives within `d`.
+func mustNoScanEvent(t *testing.T, eventCh <-chan scanner.Event, d time.Duration) {
+	timeout := time.After(d)
+	for {
+		select {
+		case e := <-eventCh:
+			if _, ok := e.(scanner.ScanEvent); ok {
+				t.Fatalf("unexpected event %#v", e)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestScanner_StartPolicyServiceID(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := startScannerWithPolicies(t, ctx, ot.Dir(), []scanner.Policy{
+		{
+			ServiceIDs: []string{"unknown"},
+			WorkerConfig: scanner.WorkerConfig{
+				PingInterval: time.Hour,
+			},
+		},
+		{
+			ServiceIDs: []string{"oniontree"},
+			WorkerConfig: scanner.WorkerConfig{
+				PingInterval: 10 * time.Millisecond,
+			},
+		},
+	})
+
+	// The service is pinged repeatedly, the default interval is an hour.
+	for i := 0; i < 3; i++ {
+		event := nextScanEvent(t, eventCh)
+		assert.Equal(t, scanner.StatusOnline, event.Status)
+	}
+}
+
+func TestScanner_StartPolicyTagChange(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := startScannerWithPolicies(t, ctx, ot.Dir(), []scanner.Policy{
+		{
+			Tags: []oniontree.Tag{"fast"},
+			WorkerConfig: scanner.WorkerConfig{
+				PingInterval: 10 * time.Millisecond,
+			},
+		},
+	})
+
+	nextScanEvent(t, eventCh)
+	mustNoScanEvent(t, eventCh, 200*time.Millisecond)
+
+	// Nested tags match too.
+	if err := ot.TagService("oniontree", []oniontree.Tag{"fast/nested"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		nextScanEvent(t, eventCh)
+	}
+
+	if err := ot.UntagService("oniontree", []oniontree.Tag{"fast/nested"}); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the scanner to notice the change, a ping may be already scheduled.
+	drainEvents(eventCh, 200*time.Millisecond)
+	mustNoScanEvent(t, eventCh, 200*time.Millisecond)
+}
+
+func TestScanner_ScanOncePolicyFromConfig(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	config := []byte(`scanner:
+  policies:
+  - services: [oniontree]
+    ping_retry_attempts: 1
+`)
+	if err := ioutil.WriteFile(path.Join(ot.Dir(), ".oniontree"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = scannertest.NewDialer()
+	cfg.WorkerConfig = testWorkerConfig
+
+	report, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if assert.Len(t, report.Results, 1) {
+		assert.Equal(t, scanner.StatusOffline, report.Results[0].Status)
+		assert.Equal(t, 1, report.Results[0].Attempts)
+	}
+}
+
+func TestScanner_StartErrorInvalidPolicyProbe(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = scannertest.NewDialer()
+	cfg.Policies = []scanner.Policy{
+		{
+			ServiceIDs: []string{"oniontree"},
+			WorkerConfig: scanner.WorkerConfig{
+				Probe: scanner.ProbeConfig{Type: "unknown"},
+			},
+		},
+	}
+
+	err := scanner.NewScanner(cfg).Start(context.Background(), ot.Dir(), make(chan scanner.Event))
+	assert.Error(t, err)
+}
+
+func TestScanner_ScanOnceErrorInvalidPolicyBackoff(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	config := []byte(`scanner:
+  policies:
+  - services: [oniontree]
+    retry_backoff: unknown
+`)
+	if err := ioutil.WriteFile(path.Join(ot.Dir(), ".oniontree"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = scannertest.NewDialer()
+	cfg.WorkerConfig = testWorkerConfig
+
+	_, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+	assert.Error(t, err)
+}
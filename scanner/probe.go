@@ -0,0 +1,207 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type ProbeType string
+
+const (
+	// ProbeTCP checks that a TCP connection can be established.
+	ProbeTCP ProbeType = "tcp"
+	// ProbeHTTP sends an HTTP GET request and checks the response.
+	ProbeHTTP ProbeType = "http"
+)
+
+// DefaultMaxResponseSize is a default limit of the response body read by ProbeHTTP.
+const DefaultMaxResponseSize = 1 << 20
+
+type ProbeConfig struct {
+	// Type of the probe, defaults to ProbeTCP.
+	Type ProbeType
+	// Path requested by ProbeHTTP, defaults to "/".
+	Path string
+	// ExpectedStatuses lists HTTP status codes of an online service.
+	// If empty, any status code lower than 400 is accepted.
+	ExpectedStatuses []int
+	// BodyPattern is a regular expression the response body must match.
+	BodyPattern string
+	// TitlePattern is a regular expression the HTML page title must match.
+	TitlePattern string
+	// MaxResponseSize limits number of bytes of the response body read,
+	// defaults to DefaultMaxResponseSize. Patterns are matched against
+	// the part of the body read.
+	MaxResponseSize int64
+}
+
+// ProbeResult holds details of a response to ProbeHTTP.
+type ProbeResult struct {
+	StatusCode int
+	Title      string
+	// BodySize is a number of bytes of the body read.
+	BodySize int64
+	// Truncated is true if the body exceeds the maximum response size.
+	Truncated bool
+}
+
+// ProbeError is returned if the service responds, but the response is not as expected.
+type ProbeError struct {
+	Reason string
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("probe failed: %s", e.Reason)
+}
+
+// probeTimes holds timings of a single probe.
+type probeTimes struct {
+	// connect is time it took to establish the connection.
+	connect time.Duration
+	// ttfb is time from sending the request to receiving the first byte of the response.
+	ttfb time.Duration
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+type prober struct {
+	config       ProbeConfig
+	bodyPattern  *regexp.Regexp
+	titlePattern *regexp.Regexp
+	client       *http.Client
+	dialer       Dialer
+}
+
+// probe checks `url` served at address `host`. Details are returned only by ProbeHTTP.
+func (p *prober) probe(ctx context.Context, url, host string) (*ProbeResult, probeTimes, error) {
+	times := probeTimes{}
+
+	if p.config.Type != ProbeHTTP {
+		start := time.Now()
+		conn, err := p.dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return nil, times, err
+		}
+		times.connect = time.Since(start)
+		_ = conn.Close()
+		return nil, times, nil
+	}
+
+	var getConn, wroteRequest time.Time
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			getConn = time.Now()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			times.connect = time.Since(getConn)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			times.ttfb = time.Since(wroteRequest)
+		},
+	}
+
+	req, err := http.NewRequest("GET", url+p.config.Path, nil)
+	if err != nil {
+		return nil, times, err
+	}
+	resp, err := p.client.Do(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	if err != nil {
+		return nil, times, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, p.config.MaxResponseSize+1))
+	if err != nil {
+		return nil, times, err
+	}
+	result := &ProbeResult{
+		StatusCode: resp.StatusCode,
+	}
+	if int64(len(body)) > p.config.MaxResponseSize {
+		body = body[:p.config.MaxResponseSize]
+		result.Truncated = true
+	}
+	result.BodySize = int64(len(body))
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		result.Title = strings.TrimSpace(html.UnescapeString(string(m[1])))
+	}
+
+	if !p.isExpectedStatus(resp.StatusCode) {
+		return result, times, &ProbeError{fmt.Sprintf("unexpected status code %d", resp.StatusCode)}
+	}
+	if p.bodyPattern != nil && !p.bodyPattern.Match(body) {
+		return result, times, &ProbeError{"body does not match the pattern"}
+	}
+	if p.titlePattern != nil && !p.titlePattern.MatchString(result.Title) {
+		return result, times, &ProbeError{fmt.Sprintf("title `%s` does not match the pattern", result.Title)}
+	}
+	return result, times, nil
+}
+
+func (p *prober) isExpectedStatus(code int) bool {
+	if len(p.config.ExpectedStatuses) == 0 {
+		return code < 400
+	}
+	for _, expected := range p.config.ExpectedStatuses {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func newProber(cfg ProbeConfig, dialer Dialer) (*prober, error) {
+	p := &prober{
+		config: cfg,
+		dialer: dialer,
+	}
+	switch cfg.Type {
+	case "", ProbeTCP:
+		return p, nil
+	case ProbeHTTP:
+	default:
+		return nil, fmt.Errorf("unsupported probe type `%s`", cfg.Type)
+	}
+
+	if p.config.Path == "" {
+		p.config.Path = "/"
+	}
+	if p.config.MaxResponseSize <= 0 {
+		p.config.MaxResponseSize = DefaultMaxResponseSize
+	}
+	var err error
+	if cfg.BodyPattern != "" {
+		if p.bodyPattern, err = regexp.Compile(cfg.BodyPattern); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TitlePattern != "" {
+		if p.titlePattern, err = regexp.Compile(cfg.TitlePattern); err != nil {
+			return nil, err
+		}
+	}
+	if dialer != nil {
+		p.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext:       dialer.DialContext,
+				DisableKeepAlives: true,
+			},
+			// Redirects are reported by the status code.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return p, nil
+}
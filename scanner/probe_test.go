@@ -0,0 +1,155 @@
+package scanner_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/scannertest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// nextScanEvent returns the next ScanEvent, skipping other events.
+func nextScanEvent(t *testing.T, eventCh <-chan scanner.Event) scanner.ScanEvent {
+	for {
+		select {
+		case e := <-eventCh:
+			if event, ok := e.(scanner.ScanEvent); ok {
+				return event
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ScanEvent")
+		}
+	}
+}
+
+func startHTTPProbe(t *testing.T, ctx context.Context, probe scanner.ProbeConfig, handler http.HandlerFunc) (<-chan scanner.Event, func() error) {
+	ot, cleanup := copyOnionTree(t)
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOnline("onions53ehmf4q75.onion")
+	dialer.SetHandler(handler)
+
+	workerCfg := testWorkerConfig
+	workerCfg.Probe = probe
+
+	return startScanner(t, ctx, ot.Dir(), dialer, workerCfg), cleanup
+}
+
+func TestScanner_ProbeHTTP(t *testing.T) {
+	const body = "<html><title> OnionTree </title>Welcome!</html>"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh, cleanup := startHTTPProbe(t, ctx, scanner.ProbeConfig{
+		Type:             scanner.ProbeHTTP,
+		ExpectedStatuses: []int{http.StatusOK},
+		BodyPattern:      "(?i)welcome",
+		TitlePattern:     "^OnionTree$",
+	}, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	})
+	defer cleanup()
+
+	event := nextScanEvent(t, eventCh)
+	assert.Equal(t, scanner.StatusOnline, event.Status)
+	assert.NoError(t, event.Error)
+	assert.Equal(t, &scanner.ProbeResult{
+		StatusCode: http.StatusOK,
+		Title:      "OnionTree",
+		BodySize:   int64(len(body)),
+	}, event.Probe)
+	assert.Equal(t, 1, event.Attempts)
+	assert.True(t, event.ConnectTime > 0)
+	assert.True(t, event.TTFB > 0)
+}
+
+func TestScanner_ProbeHTTPFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		probe   scanner.ProbeConfig
+		handler http.HandlerFunc
+		status  int
+	}{
+		{
+			name:  "status code",
+			probe: scanner.ProbeConfig{Type: scanner.ProbeHTTP},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			status: http.StatusBadGateway,
+		},
+		{
+			name:  "body pattern",
+			probe: scanner.ProbeConfig{Type: scanner.ProbeHTTP, BodyPattern: "welcome"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "Tor error page")
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:  "title pattern",
+			probe: scanner.ProbeConfig{Type: scanner.ProbeHTTP, TitlePattern: "OnionTree"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "<title>Gone</title>")
+			},
+			status: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			eventCh, cleanup := startHTTPProbe(t, ctx, test.probe, test.handler)
+			defer cleanup()
+
+			event := nextScanEvent(t, eventCh)
+			assert.Equal(t, scanner.StatusOffline, event.Status)
+			assert.IsType(t, &scanner.ProbeError{}, event.Error)
+			if assert.NotNil(t, event.Probe) {
+				assert.Equal(t, test.status, event.Probe.StatusCode)
+			}
+		})
+	}
+}
+
+func TestScanner_ProbeHTTPMaxResponseSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh, cleanup := startHTTPProbe(t, ctx, scanner.ProbeConfig{
+		Type:            scanner.ProbeHTTP,
+		MaxResponseSize: 5,
+		BodyPattern:     "^hello$",
+	}, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello world")
+	})
+	defer cleanup()
+
+	event := nextScanEvent(t, eventCh)
+	assert.Equal(t, scanner.StatusOnline, event.Status)
+	assert.Equal(t, &scanner.ProbeResult{
+		StatusCode: http.StatusOK,
+		BodySize:   5,
+		Truncated:  true,
+	}, event.Probe)
+}
+
+func TestScanner_StartErrorInvalidProbe(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = scannertest.NewDialer()
+	cfg.WorkerConfig.Probe = scanner.ProbeConfig{
+		Type:        scanner.ProbeHTTP,
+		BodyPattern: "(",
+	}
+
+	err := scanner.NewScanner(cfg).Start(context.Background(), ot.Dir(), make(chan scanner.Event))
+	assert.Error(t, err)
+}
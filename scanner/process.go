@@ -9,7 +9,10 @@ import (
 
 type Process struct {
 	workerConfig WorkerConfig
+	dialer       Dialer
+	limiter      *connLimiter
 	reloadCh     chan int
+	configCh     chan WorkerConfig
 	ot           *oniontree.OnionTree
 	cancel       context.CancelFunc
 }
@@ -17,14 +20,19 @@ type Process struct {
 func (p *Process) Start(ctx context.Context, serviceID string, outputCh chan<- Event) error {
 	ctx, p.cancel = context.WithCancel(ctx)
 	wCtx, wCtxCancel := context.WithCancel(context.Background())
+	defer wCtxCancel()
 
 	emitEvent := func(event Event) {
 		if e, ok := event.(workerStatus); ok {
 			event = processStatus{
-				Status:    e.Status,
-				URL:       e.URL,
-				ServiceID: serviceID,
-				Error:     e.Error,
+				Status:      e.Status,
+				URL:         e.URL,
+				ServiceID:   serviceID,
+				Error:       e.Error,
+				Probe:       e.Probe,
+				ConnectTime: e.ConnectTime,
+				TTFB:        e.TTFB,
+				Attempts:    e.Attempts,
 			}
 		}
 		//fmt.Printf("%s :: %+v\n", reflect.TypeOf(event), event)
@@ -77,13 +85,14 @@ func (p *Process) Start(ctx context.Context, serviceID string, outputCh chan<- E
 		if workerExists(url) {
 			return
 		}
-		workers[url] = newWorker(p.workerConfig)
+		worker := newWorker(p.workerConfig, p.dialer, p.limiter)
+		workers[url] = worker
 		workersEventCh <- WorkerStarted{
 			URL:       url,
 			ServiceID: serviceID,
 		}
 		go func() {
-			err := workers[url].Start(wCtx, url, workersEventCh)
+			err := worker.Start(wCtx, url, workersEventCh)
 			workersEventCh <- WorkerStopped{
 				URL:       url,
 				ServiceID: serviceID,
@@ -150,6 +159,14 @@ func (p *Process) Start(ctx context.Context, serviceID string, outputCh chan<- E
 				startNewWorker(url)
 			}
 
+		case cfg := <-p.configCh:
+			p.workerConfig = cfg
+			for url := range workers {
+				if workerExists(url) {
+					workers[url].Reconfigure(cfg)
+				}
+			}
+
 		// Read from workers event channel and forward the data to the scanner.
 		case event := <-workersEventCh:
 			if e, ok := event.(WorkerStopped); ok {
@@ -167,6 +184,16 @@ func (p *Process) Stop() {
 	p.cancel()
 }
 
+// Reconfigure makes workers of the process use configuration `cfg`. It doesn't block,
+// a pending configuration is replaced.
+func (p *Process) Reconfigure(cfg WorkerConfig) {
+	select {
+	case <-p.configCh:
+	default:
+	}
+	p.configCh <- cfg
+}
+
 func (p *Process) Reload(ctx context.Context) {
 	select {
 	case p.reloadCh <- 1:
@@ -174,10 +201,13 @@ func (p *Process) Reload(ctx context.Context) {
 	}
 }
 
-func newProcess(ot *oniontree.OnionTree, cfg WorkerConfig) *Process {
+func newProcess(ot *oniontree.OnionTree, cfg WorkerConfig, dialer Dialer, limiter *connLimiter) *Process {
 	return &Process{
 		ot:           ot,
 		reloadCh:     make(chan int),
+		configCh:     make(chan WorkerConfig, 1),
 		workerConfig: cfg,
+		dialer:       dialer,
+		limiter:      limiter,
 	}
 }
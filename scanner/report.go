@@ -0,0 +1,39 @@
+package scanner
+
+import "sort"
+
+// ScanReport holds results of Scanner.ScanOnce.
+type ScanReport struct {
+	Directory string
+	// Results holds a result for each URL, sorted by service ID and URL.
+	Results []ScanEvent
+}
+
+// Online returns results of URLs that are online.
+func (r *ScanReport) Online() []ScanEvent {
+	return r.filter(StatusOnline)
+}
+
+// Offline returns results of URLs that are offline.
+func (r *ScanReport) Offline() []ScanEvent {
+	return r.filter(StatusOffline)
+}
+
+func (r *ScanReport) filter(status Status) []ScanEvent {
+	results := []ScanEvent{}
+	for i := range r.Results {
+		if r.Results[i].Status == status {
+			results = append(results, r.Results[i])
+		}
+	}
+	return results
+}
+
+func (r *ScanReport) sort() {
+	sort.Slice(r.Results, func(i, j int) bool {
+		if r.Results[i].ServiceID != r.Results[j].ServiceID {
+			return r.Results[i].ServiceID < r.Results[j].ServiceID
+		}
+		return r.Results[i].URL < r.Results[j].URL
+	})
+}
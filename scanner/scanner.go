@@ -5,46 +5,98 @@ import (
 	"fmt"
 	"github.com/oniontree-org/go-oniontree"
 	"github.com/oniontree-org/go-oniontree/watcher"
-	"golang.org/x/sync/semaphore"
+	"reflect"
 	"runtime/debug"
+	"time"
 )
 
 type ScannerConfig struct {
 	// WorkerConnectionsMax limits number of parallel outbound TCP connections.
 	WorkerTCPConnectionsMax int64
+	// WorkerTCPConnectionsPerHostMax limits number of parallel outbound TCP connections
+	// to a single host, so that a slow host can't take all of them. Zero means no limit.
+	WorkerTCPConnectionsPerHostMax int64
+	// HostTCPConnectionsMax overrides WorkerTCPConnectionsPerHostMax for selected hosts.
+	// Format: HostTCPConnectionsMax[host] = limit, zero means no limit
+	HostTCPConnectionsMax map[string]int64
 	// WorkerConfig is a configuration passed to workers.
 	WorkerConfig WorkerConfig
+	// Policies set WorkerConfig of selected services. The first policy matching
+	// a service applies. Policies from the repository configuration follow these.
+	Policies []Policy
+	// Dialer is used to connect to the services. If set, ProxyAddress is ignored.
+	Dialer Dialer
+	// ProxyAddress is an address of a SOCKS5 proxy, e.g. Tor's "127.0.0.1:9050".
+	// If neither Dialer nor ProxyAddress is set, the proxy is taken
+	// from environment variable ALL_PROXY.
+	ProxyAddress string
+	// IsolateStreams makes connections to each service authenticate to the SOCKS5
+	// proxy with distinct credentials, so that Tor uses a separate circuit for each service.
+	IsolateStreams bool
+	// AllowDirect allows the scanner to connect to the services without a proxy.
+	AllowDirect bool
+	// ScanDead makes the scanner scan also services tagged DeadTag,
+	// e.g. so that they can be untagged once they're back online.
+	ScanDead bool
 }
 
+// DeadTag is a tag of services the scanner skips, unless ScannerConfig.ScanDead is true.
+const DeadTag oniontree.Tag = "dead"
+
+// rescheduleDelay is how long policies wait for further tag changes before they're resolved again.
+const rescheduleDelay = 100 * time.Millisecond
+
 type Scanner struct {
-	config ScannerConfig
-	ot     *oniontree.OnionTree
-	cancel context.CancelFunc
+	config  ScannerConfig
+	limiter *connLimiter
+	ot      *oniontree.OnionTree
+	cancel  context.CancelFunc
 }
 
 var DefaultScannerConfig = ScannerConfig{
-	WorkerTCPConnectionsMax: 256,
-	WorkerConfig:            DefaultWorkerConfig,
+	WorkerTCPConnectionsMax:        256,
+	WorkerTCPConnectionsPerHostMax: 4,
+	WorkerConfig:                   DefaultWorkerConfig,
+	IsolateStreams:                 true,
 }
 
 func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event) error {
+	serviceDialer, err := newDialer(m.config)
+	if err != nil {
+		return err
+	}
+	// Validate the probe configuration before any worker is started.
+	if err := validateProbes(m.config); err != nil {
+		return err
+	}
+
 	ot, err := oniontree.Open(dir)
 	if err != nil {
 		return err
 	}
 	m.ot = ot
 
+	sched, err := newSchedule(ot, m.config)
+	if err != nil {
+		return err
+	}
+
 	ctx, m.cancel = context.WithCancel(ctx)
 	pCtx, pCtxCancel := context.WithCancel(context.Background())
+	defer pCtxCancel()
 
 	emitEvent := func(event Event) {
 		if e, ok := event.(processStatus); ok {
 			event = ScanEvent{
-				Status:    e.Status,
-				URL:       e.URL,
-				ServiceID: e.ServiceID,
-				Directory: dir,
-				Error:     e.Error,
+				Status:      e.Status,
+				URL:         e.URL,
+				ServiceID:   e.ServiceID,
+				Directory:   dir,
+				Error:       e.Error,
+				Probe:       e.Probe,
+				ConnectTime: e.ConnectTime,
+				TTFB:        e.TTFB,
+				Attempts:    e.Attempts,
 			}
 		}
 		//fmt.Printf("%s :: %+v\n", reflect.TypeOf(event), event)
@@ -53,7 +105,7 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 		}
 	}
 	loadServices := func() (map[string]*Process, error) {
-		serviceIDs, err := m.ot.ListServices()
+		serviceIDs, err := m.listServices(m.ot)
 		if err != nil {
 			return nil, err
 		}
@@ -62,23 +114,9 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 		for i := range serviceIDs {
 			procs[serviceIDs[i]] = nil
 		}
-
-		deadServiceIDs, err := m.ot.ListServicesWithTag("dead")
-		if err != nil {
-			if _, ok := err.(*oniontree.ErrTagNotExists); !ok {
-				return nil, err
-			}
-			return procs, nil
-		}
-
-		for i := range deadServiceIDs {
-			delete(procs, deadServiceIDs[i])
-		}
 		return procs, nil
 	}
 
-	workerConnSem = semaphore.NewWeighted(m.config.WorkerTCPConnectionsMax)
-
 	const procsChCapacity = 512
 	procsEventCh := make(chan Event, procsChCapacity)
 
@@ -87,6 +125,9 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 		return err
 	}
 
+	// Format: workerConfigs[serviceID] = configuration used by the process
+	workerConfigs := make(map[string]WorkerConfig, len(procs))
+
 	processExists := func(serviceID string) bool {
 		if p, ok := procs[serviceID]; ok {
 			return p != nil
@@ -99,17 +140,20 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 		}
 		procs[serviceID].Stop()
 		delete(procs, serviceID)
+		delete(workerConfigs, serviceID)
 	}
 	startNewProcess := func(serviceID string) {
 		if processExists(serviceID) {
 			return
 		}
-		procs[serviceID] = newProcess(m.ot, m.config.WorkerConfig)
+		workerConfigs[serviceID] = sched.workerConfig(serviceID)
+		proc := newProcess(m.ot, workerConfigs[serviceID], serviceDialer(serviceID), m.limiter)
+		procs[serviceID] = proc
 		procsEventCh <- ProcessStarted{
 			ServiceID: serviceID,
 		}
 		go func() {
-			err := procs[serviceID].Start(pCtx, serviceID, procsEventCh)
+			err := proc.Start(pCtx, serviceID, procsEventCh)
 			procsEventCh <- ProcessStopped{
 				ServiceID: serviceID,
 				Error:     err,
@@ -123,6 +167,22 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 		procs[serviceID].Reload(pCtx)
 	}
 
+	// reschedule reconfigures processes whose policy changed.
+	reschedule := func() error {
+		if err := sched.load(m.ot); err != nil {
+			return err
+		}
+		for serviceID, cfg := range workerConfigs {
+			newCfg := sched.workerConfig(serviceID)
+			if reflect.DeepEqual(cfg, newCfg) {
+				continue
+			}
+			workerConfigs[serviceID] = newCfg
+			procs[serviceID].Reconfigure(newCfg)
+		}
+		return nil
+	}
+
 	for serviceID := range procs {
 		startNewProcess(serviceID)
 	}
@@ -154,6 +214,15 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 	watcherEventCh := make(chan watcher.Event)
 	watcherErrCh := make(chan error, 1)
 
+	// Tags are resolved once per burst of tag changes, e.g. when a tag is renamed.
+	var rescheduleCh <-chan time.Time
+	scheduleReschedule := func() {
+		if rescheduleCh != nil || !sched.hasTags() {
+			return
+		}
+		rescheduleCh = time.After(rescheduleDelay)
+	}
+
 	w := watcher.NewWatcher(ot)
 	go func() {
 		if err := w.Watch(ctx, watcherEventCh); err != nil {
@@ -179,18 +248,26 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 				destroyRunningProcess(event.ID)
 
 			case watcher.ServiceTagged:
-				if event.Tag != "dead" {
+				scheduleReschedule()
+				if event.Tag != DeadTag.String() || m.config.ScanDead {
 					continue
 				}
 				destroyRunningProcess(event.ID)
 
 			case watcher.ServiceUntagged:
-				if event.Tag != "dead" {
+				scheduleReschedule()
+				if event.Tag != DeadTag.String() || m.config.ScanDead {
 					continue
 				}
 				startNewProcess(event.ID)
 			}
 
+		case <-rescheduleCh:
+			rescheduleCh = nil
+			if err := reschedule(); err != nil {
+				return err
+			}
+
 		case err := <-watcherErrCh:
 			return err
 
@@ -206,12 +283,166 @@ func (m *Scanner) Start(ctx context.Context, dir string, outputCh chan<- Event)
 	}
 }
 
+// ScanOnce checks every URL of services in `dir` once and returns the results.
+// Services for which `filter` returns false are skipped, as are services tagged DeadTag.
+// Failed attempts are retried according to WorkerConfig.
+func (m *Scanner) ScanOnce(ctx context.Context, dir string, filter func(serviceID string) bool) (*ScanReport, error) {
+	serviceDialer, err := newDialer(m.config)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProbes(m.config); err != nil {
+		return nil, err
+	}
+
+	ot, err := oniontree.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sched, err := newSchedule(ot, m.config)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceIDs, err := m.listServices(ot)
+	if err != nil {
+		return nil, err
+	}
+
+	type target struct {
+		serviceID string
+		url       string
+	}
+	targets := []target{}
+	for _, serviceID := range serviceIDs {
+		if filter != nil && !filter(serviceID) {
+			continue
+		}
+		service, err := ot.GetService(serviceID)
+		if err != nil {
+			return nil, err
+		}
+
+		urls := map[string]struct{}{}
+		for _, url := range service.URLs {
+			url, err := Normalize(url)
+			if err != nil {
+				continue
+			}
+			if _, ok := urls[url]; ok {
+				continue
+			}
+			urls[url] = struct{}{}
+			targets = append(targets, target{serviceID, url})
+		}
+	}
+
+	type result struct {
+		status    workerStatus
+		serviceID string
+		err       error
+	}
+	resultCh := make(chan result, len(targets))
+
+	for _, t := range targets {
+		go func(t target) {
+			worker := newWorker(sched.workerConfig(t.serviceID), serviceDialer(t.serviceID), m.limiter)
+			status, err := worker.scan(ctx, t.url)
+			resultCh <- result{
+				status:    status,
+				serviceID: t.serviceID,
+				err:       err,
+			}
+		}(t)
+	}
+
+	report := &ScanReport{
+		Directory: dir,
+		Results:   make([]ScanEvent, 0, len(targets)),
+	}
+	for range targets {
+		r := <-resultCh
+		if r.err != nil {
+			if err == nil {
+				err = r.err
+			}
+			continue
+		}
+		report.Results = append(report.Results, ScanEvent{
+			Status:      r.status.Status,
+			URL:         r.status.URL,
+			ServiceID:   r.serviceID,
+			Directory:   dir,
+			Error:       r.status.Error,
+			Probe:       r.status.Probe,
+			ConnectTime: r.status.ConnectTime,
+			TTFB:        r.status.TTFB,
+			Attempts:    r.status.Attempts,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report.sort()
+	return report, nil
+}
+
 func (m *Scanner) Stop() {
 	m.cancel()
 }
 
+// validateProbes returns an error if any probe configuration is invalid.
+func validateProbes(cfg ScannerConfig) error {
+	if _, err := newProber(cfg.WorkerConfig.Probe, nil); err != nil {
+		return err
+	}
+	for i := range cfg.Policies {
+		if _, err := newProber(cfg.Policies[i].WorkerConfig.Probe, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listServices returns IDs of services in `ot` to be scanned.
+func (m *Scanner) listServices(ot *oniontree.OnionTree) ([]string, error) {
+	serviceIDs, err := ot.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	if m.config.ScanDead {
+		return serviceIDs, nil
+	}
+
+	deadServiceIDs, err := ot.ListServicesWithTag(DeadTag)
+	if err != nil {
+		if _, ok := err.(*oniontree.ErrTagNotExists); !ok {
+			return nil, err
+		}
+		return serviceIDs, nil
+	}
+
+	dead := make(map[string]struct{}, len(deadServiceIDs))
+	for i := range deadServiceIDs {
+		dead[deadServiceIDs[i]] = struct{}{}
+	}
+	live := make([]string, 0, len(serviceIDs))
+	for i := range serviceIDs {
+		if _, ok := dead[serviceIDs[i]]; !ok {
+			live = append(live, serviceIDs[i])
+		}
+	}
+	return live, nil
+}
+
 func NewScanner(cfg ScannerConfig) *Scanner {
 	return &Scanner{
-		config: cfg,
+		config:  cfg,
+		limiter: newConnLimiter(cfg),
 	}
 }
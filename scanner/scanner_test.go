@@ -2,15 +2,16 @@ package scanner_test
 
 import (
 	"context"
-	"fmt"
 	"github.com/oniontree-org/go-oniontree"
 	"github.com/oniontree-org/go-oniontree/scanner"
+	"github.com/oniontree-org/go-oniontree/scanner/scannertest"
 	"github.com/otiai10/copy"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 func newTempDir(t *testing.T) string {
@@ -34,45 +35,85 @@ func copyOnionTree(t *testing.T) (*oniontree.OnionTree, func() error) {
 func mustEvent(t *testing.T, event scanner.Event, eventCh <-chan scanner.Event) {
 	select {
 	case e := <-eventCh:
+		// Timings vary between runs, they're compared only if expected.
+		if scanEvent, ok := e.(scanner.ScanEvent); ok {
+			if expected, ok := event.(scanner.ScanEvent); ok {
+				assert.True(t, scanEvent.ConnectTime >= 0)
+				assert.True(t, scanEvent.TTFB >= 0)
+				if expected.ConnectTime == 0 {
+					scanEvent.ConnectTime = 0
+				}
+				if expected.TTFB == 0 {
+					scanEvent.TTFB = 0
+				}
+				e = scanEvent
+			}
+		}
 		if !assert.Equal(t, event, e) {
 			t.Fatal("unexpected event")
 		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for event %#v", event)
 	}
 }
 
-func TestScanner_Start(t *testing.T) {
-	ot, cleanup := copyOnionTree(t)
-	defer cleanup()
-
-	fmt.Println(ot.Dir())
+// startScanner starts a scanner connecting to the services through `dialer`
+// and returns a channel with its events.
+func startScanner(t *testing.T, ctx context.Context, dir string, dialer scanner.Dialer, workerCfg scanner.WorkerConfig) <-chan scanner.Event {
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = workerCfg
 
 	eventCh := make(chan scanner.Event)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	scnr := scanner.NewScanner(scanner.DefaultScannerConfig)
+	scnr := scanner.NewScanner(cfg)
 
 	go func() {
-		if err := scnr.Start(ctx, ot.Dir(), eventCh); err != nil {
+		if err := scnr.Start(ctx, dir, eventCh); err != nil {
 			log.Printf("%s\n", err)
 			return
 		}
 	}()
 
+	return eventCh
+}
+
+// testWorkerConfig is a worker configuration with short intervals suitable for tests.
+var testWorkerConfig = scanner.WorkerConfig{
+	PingInterval:      1 * time.Hour,
+	PingTimeout:       1 * time.Second,
+	PingPauseInterval: 1 * time.Hour,
+	PingRetryInterval: 10 * time.Millisecond,
+	PingRetryAttempts: 3,
+}
+
+const testURL = "http://onions53ehmf4q75.onion"
+
+func TestScanner_Start(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOnline("onions53ehmf4q75.onion")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := startScanner(t, ctx, ot.Dir(), dialer, testWorkerConfig)
+
 	mustEvent(t, scanner.ProcessStarted{
 		ServiceID: "oniontree",
 	}, eventCh)
 	mustEvent(t, scanner.WorkerStarted{
-		URL:       "http://onions53ehmf4q75.onion",
+		URL:       testURL,
 		ServiceID: "oniontree",
 	}, eventCh)
 	mustEvent(t, scanner.ScanEvent{
 		Status:    scanner.StatusOnline,
-		URL:       "http://onions53ehmf4q75.onion",
+		URL:       testURL,
 		ServiceID: "oniontree",
 		Directory: ot.Dir(),
 		Error:     nil,
+		Attempts:  1,
 	}, eventCh)
 
 	// Cancel the context so we can check if the scanner shuts down cleanly.
@@ -80,13 +121,13 @@ func TestScanner_Start(t *testing.T) {
 
 	mustEvent(t, scanner.ScanEvent{
 		Status:    scanner.StatusOffline,
-		URL:       "http://onions53ehmf4q75.onion",
+		URL:       testURL,
 		ServiceID: "oniontree",
 		Directory: ot.Dir(),
 		Error:     context.Canceled,
 	}, eventCh)
 	mustEvent(t, scanner.WorkerStopped{
-		URL:       "http://onions53ehmf4q75.onion",
+		URL:       testURL,
 		ServiceID: "oniontree",
 		Error:     nil,
 	}, eventCh)
@@ -94,3 +135,336 @@ func TestScanner_Start(t *testing.T) {
 		ServiceID: "oniontree",
 	}, eventCh)
 }
+
+func TestScanner_StartOffline(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOffline("onions53ehmf4q75.onion")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := startScanner(t, ctx, ot.Dir(), dialer, testWorkerConfig)
+
+	mustEvent(t, scanner.ProcessStarted{
+		ServiceID: "oniontree",
+	}, eventCh)
+	mustEvent(t, scanner.WorkerStarted{
+		URL:       testURL,
+		ServiceID: "oniontree",
+	}, eventCh)
+	// The service is reported offline only after all retry attempts fail.
+	mustEvent(t, scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       testURL,
+		ServiceID: "oniontree",
+		Directory: ot.Dir(),
+		Error:     scannertest.ErrOffline,
+		Attempts:  testWorkerConfig.PingRetryAttempts,
+	}, eventCh)
+	assert.Equal(t, testWorkerConfig.PingRetryAttempts, dialer.Dials("onions53ehmf4q75.onion"))
+}
+
+func TestScanner_StartStatusChange(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	dialer := scannertest.NewDialer()
+	// A single failure is followed by a successful retry, the service is online.
+	// After that, it goes offline.
+	dialer.Script("onions53ehmf4q75.onion", scannertest.ErrOffline, nil, scannertest.ErrOffline)
+
+	workerCfg := testWorkerConfig
+	workerCfg.PingInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := startScanner(t, ctx, ot.Dir(), dialer, workerCfg)
+
+	mustEvent(t, scanner.ProcessStarted{
+		ServiceID: "oniontree",
+	}, eventCh)
+	mustEvent(t, scanner.WorkerStarted{
+		URL:       testURL,
+		ServiceID: "oniontree",
+	}, eventCh)
+	mustEvent(t, scanner.ScanEvent{
+		Status:    scanner.StatusOnline,
+		URL:       testURL,
+		ServiceID: "oniontree",
+		Directory: ot.Dir(),
+		Error:     nil,
+		Attempts:  2,
+	}, eventCh)
+	mustEvent(t, scanner.ScanEvent{
+		Status:    scanner.StatusOffline,
+		URL:       testURL,
+		ServiceID: "oniontree",
+		Directory: ot.Dir(),
+		Error:     scannertest.ErrOffline,
+		Attempts:  testWorkerConfig.PingRetryAttempts,
+	}, eventCh)
+}
+
+func TestScanner_ScanOnce(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	const offlineURL = "http://expyuzz4wqqyqhjn.onion"
+	const deadURL = "http://3g2upl4pq6kufc4m.onion"
+
+	addService := func(id, url string, tags ...oniontree.Tag) {
+		service := oniontree.NewService(id)
+		service.Name = id
+		service.SetURLs([]string{url})
+		if err := ot.AddService(service); err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) > 0 {
+			if err := ot.TagService(id, tags); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	addService("example", offlineURL)
+	addService("gone", deadURL, "dead")
+
+	dialer := scannertest.NewDialer()
+	// The service is online only after a failed attempt.
+	dialer.Script("onions53ehmf4q75.onion", scannertest.ErrOffline, nil)
+	dialer.SetOnline("3g2upl4pq6kufc4m.onion")
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = testWorkerConfig
+
+	report, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for i := range report.Results {
+		report.Results[i].ConnectTime = 0
+	}
+	assert.Equal(t, &scanner.ScanReport{
+		Directory: ot.Dir(),
+		Results: []scanner.ScanEvent{
+			{
+				Status:    scanner.StatusOffline,
+				URL:       offlineURL,
+				ServiceID: "example",
+				Directory: ot.Dir(),
+				Error:     scannertest.ErrOffline,
+				Attempts:  testWorkerConfig.PingRetryAttempts,
+			},
+			{
+				Status:    scanner.StatusOnline,
+				URL:       testURL,
+				ServiceID: "oniontree",
+				Directory: ot.Dir(),
+				Attempts:  2,
+			},
+		},
+	}, report)
+	assert.Len(t, report.Online(), 1)
+	assert.Len(t, report.Offline(), 1)
+
+	// Services tagged "dead" are not scanned.
+	assert.Equal(t, 0, dialer.Dials("3g2upl4pq6kufc4m.onion"))
+}
+
+func TestScanner_ScanOnceFilter(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOnline("onions53ehmf4q75.onion")
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = testWorkerConfig
+
+	report, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), func(serviceID string) bool {
+		return serviceID != "oniontree"
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Empty(t, report.Results)
+	assert.Equal(t, 0, dialer.Dials("onions53ehmf4q75.onion"))
+}
+
+func TestScanner_ScanOnceCanceled(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = scannertest.NewDialer()
+	cfg.WorkerConfig = testWorkerConfig
+	cfg.WorkerConfig.PingRetryInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := scanner.NewScanner(cfg).ScanOnce(ctx, ot.Dir(), nil)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestScanner_StartScanDead(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	if err := ot.TagService("oniontree", []oniontree.Tag{scanner.DeadTag}); err != nil {
+		t.Fatal(err)
+	}
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOnline("onions53ehmf4q75.onion")
+
+	cfg := scanner.DefaultScannerConfig
+	cfg.Dialer = dialer
+	cfg.WorkerConfig = testWorkerConfig
+	cfg.ScanDead = true
+
+	report, err := scanner.NewScanner(cfg).ScanOnce(context.Background(), ot.Dir(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if assert.Len(t, report.Results, 1) {
+		assert.Equal(t, scanner.StatusOnline, report.Results[0].Status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := make(chan scanner.Event)
+	go func() {
+		_ = scanner.NewScanner(cfg).Start(ctx, ot.Dir(), eventCh)
+	}()
+
+	mustEvent(t, scanner.ProcessStarted{
+		ServiceID: "oniontree",
+	}, eventCh)
+	mustEvent(t, scanner.WorkerStarted{
+		URL:       testURL,
+		ServiceID: "oniontree",
+	}, eventCh)
+	mustEvent(t, scanner.ScanEvent{
+		Status:    scanner.StatusOnline,
+		URL:       testURL,
+		ServiceID: "oniontree",
+		Directory: ot.Dir(),
+		Attempts:  1,
+	}, eventCh)
+}
+
+// scanTimes collects times of `n` ScanEvents per worker.
+// Format: times[serviceID+" "+URL] = times of the ScanEvents
+func scanTimes(t *testing.T, eventCh <-chan scanner.Event, workers, n int) map[string][]time.Time {
+	times := make(map[string][]time.Time, workers)
+	for remaining := workers * n; remaining > 0; {
+		select {
+		case e := <-eventCh:
+			scanEvent, ok := e.(scanner.ScanEvent)
+			if !ok {
+				continue
+			}
+			key := scanEvent.ServiceID + " " + scanEvent.URL
+			if len(times[key]) < n {
+				times[key] = append(times[key], time.Now())
+				remaining--
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for scan events")
+		}
+	}
+	return times
+}
+
+// assertJitteredIntervals checks that intervals between the times are within
+// (`interval` * (1 - `fraction`), `interval`], give or take delays of the events,
+// and that they're not all the same.
+func assertJitteredIntervals(t *testing.T, times []time.Time, interval time.Duration, fraction float64) {
+	const slack = 30 * time.Millisecond
+	min, max := time.Duration(1<<63-1), time.Duration(0)
+	for i := 1; i < len(times); i++ {
+		d := times[i].Sub(times[i-1])
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	assert.True(t, min >= time.Duration(float64(interval)*(1-fraction))-slack, "shortest interval %s", min)
+	assert.True(t, max <= interval+3*slack, "longest interval %s", max)
+	assert.True(t, max-min > 5*time.Millisecond, "intervals don't vary: %s..%s", min, max)
+}
+
+func TestScanner_StartJitter(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addMirrors(t, ot, 4)
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOnline("onions53ehmf4q75.onion")
+
+	workerCfg := testWorkerConfig
+	workerCfg.PingInterval = 100 * time.Millisecond
+	workerCfg.Jitter = 0.5
+	workerCfg.StartJitter = 300 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	eventCh := startScanner(t, ctx, ot.Dir(), dialer, workerCfg)
+	times := scanTimes(t, eventCh, 9, 10)
+
+	// First pings are spread over StartJitter.
+	first, last := time.Now(), start
+	for _, ts := range times {
+		if ts[0].Before(first) {
+			first = ts[0]
+		}
+		if ts[0].After(last) {
+			last = ts[0]
+		}
+	}
+	assert.True(t, last.Sub(start) < workerCfg.StartJitter+100*time.Millisecond, "first ping after %s", last.Sub(start))
+	assert.True(t, last.Sub(first) > 10*time.Millisecond, "first pings within %s", last.Sub(first))
+
+	for _, ts := range times {
+		assertJitteredIntervals(t, ts, workerCfg.PingInterval, workerCfg.Jitter)
+	}
+}
+
+func TestScanner_StartJitterPause(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	dialer := scannertest.NewDialer()
+	dialer.SetOffline("onions53ehmf4q75.onion")
+
+	workerCfg := testWorkerConfig
+	workerCfg.PingRetryAttempts = 1
+	workerCfg.PingPauseInterval = 100 * time.Millisecond
+	workerCfg.Jitter = 0.5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh := startScanner(t, ctx, ot.Dir(), dialer, workerCfg)
+	times := scanTimes(t, eventCh, 1, 10)
+
+	for _, ts := range times {
+		assertJitteredIntervals(t, ts, workerCfg.PingPauseInterval, workerCfg.Jitter)
+	}
+}
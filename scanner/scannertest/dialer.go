@@ -0,0 +1,140 @@
+// Package scannertest provides utilities for testing code using the scanner
+// without access to the network.
+package scannertest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ErrOffline is returned by Dialer when connecting to an offline host.
+var ErrOffline = errors.New("host is offline")
+
+// Dialer is a fake scanner.Dialer returning scripted results per host.
+// Connections to online hosts are served in memory, by an HTTP handler if
+// one is set, otherwise any data written to them are discarded.
+//
+// Hosts are matched by address "host:port" first, then by the host alone.
+// Hosts without a script are offline.
+type Dialer struct {
+	mu      sync.Mutex
+	scripts map[string][]error
+	dials   map[string]int
+	handler http.Handler
+}
+
+// SetOnline makes all subsequent connections to `host` succeed.
+func (d *Dialer) SetOnline(host string) {
+	d.Script(host, nil)
+}
+
+// SetOffline makes all subsequent connections to `host` fail with ErrOffline.
+func (d *Dialer) SetOffline(host string) {
+	d.Script(host, ErrOffline)
+}
+
+// Script sets results of subsequent connections to `host`. Each connection
+// consumes one result, nil meaning the host is online. The last result is
+// repeated once the others are consumed.
+func (d *Dialer) Script(host string, results ...error) {
+	if len(results) == 0 {
+		panic("scannertest: at least one result is required")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.scripts[host] = results
+}
+
+// SetHandler sets an HTTP handler serving connections to online hosts.
+func (d *Dialer) SetHandler(handler http.Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handler = handler
+}
+
+// Dials returns number of connections made to `host`. Connections are counted
+// under the same key the host is matched by.
+func (d *Dialer) Dials(host string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials[host]
+}
+
+// nextResult returns a result of the next connection to `address`.
+func (d *Dialer) nextResult(address string) (http.Handler, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := address
+	if _, ok := d.scripts[key]; !ok {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			key = host
+		}
+	}
+	d.dials[key]++
+
+	results, ok := d.scripts[key]
+	if !ok {
+		return nil, ErrOffline
+	}
+	if len(results) > 1 {
+		d.scripts[key] = results[1:]
+	}
+	return d.handler, results[0]
+}
+
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	handler, err := d.nextResult(address)
+	if err != nil {
+		return nil, err
+	}
+
+	client, server := net.Pipe()
+	go serve(server, handler)
+	return client, nil
+}
+
+// serve serves connection `conn` by `handler` until it's closed.
+func serve(conn net.Conn, handler http.Handler) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	if handler == nil {
+		_, _ = reader.WriteTo(ioutil.Discard)
+		return
+	}
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		resp := rec.Result()
+		// Without the length, the response would be terminated by closing the connection.
+		resp.ContentLength = int64(rec.Body.Len())
+		if err := resp.Write(conn); err != nil {
+			return
+		}
+		if req.Close {
+			return
+		}
+	}
+}
+
+// NewDialer returns a new Dialer with all hosts offline.
+func NewDialer() *Dialer {
+	return &Dialer{
+		scripts: make(map[string][]error),
+		dials:   make(map[string]int),
+	}
+}
@@ -0,0 +1,71 @@
+package scannertest_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/oniontree-org/go-oniontree/scanner/scannertest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestDialer_Script(t *testing.T) {
+	d := scannertest.NewDialer()
+	d.Script("example.onion", scannertest.ErrOffline, nil)
+
+	ctx := context.Background()
+
+	_, err := d.DialContext(ctx, "tcp", "example.onion:80")
+	assert.Equal(t, scannertest.ErrOffline, err)
+
+	// The last result is repeated.
+	for i := 0; i < 2; i++ {
+		conn, err := d.DialContext(ctx, "tcp", "example.onion:80")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		_ = conn.Close()
+	}
+	assert.Equal(t, 3, d.Dials("example.onion"))
+
+	// Hosts without a script are offline.
+	_, err = d.DialContext(ctx, "tcp", "unknown.onion:80")
+	assert.Equal(t, scannertest.ErrOffline, err)
+}
+
+func TestDialer_SetHandler(t *testing.T) {
+	d := scannertest.NewDialer()
+	d.SetOnline("example.onion:80")
+	d.SetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprintf(w, "host=%s", r.Host)
+	}))
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.onion:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req, err := http.NewRequest("GET", "http://example.onion/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	assert.Equal(t, "host=example.onion", string(body))
+}
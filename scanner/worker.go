@@ -3,7 +3,6 @@ package scanner
 import (
 	"context"
 	"fmt"
-	"golang.org/x/net/proxy"
 	"runtime/debug"
 	"time"
 )
@@ -14,11 +13,26 @@ type WorkerConfig struct {
 	PingPauseInterval time.Duration
 	PingRetryInterval time.Duration
 	PingRetryAttempts int
+	// RetryBackoff sets intervals between retries, PingRetryInterval being
+	// the base interval. Defaults to FixedBackoff without jitter if nil.
+	RetryBackoff Backoff
+	// Jitter is a fraction of PingInterval and PingPauseInterval randomly
+	// subtracted from them, so that workers don't ping in lockstep.
+	// In a Policy, zero means the default and a negative value disables it.
+	Jitter float64
+	// StartJitter delays the first ping by a random time up to StartJitter.
+	// In a Policy, zero means the default and a negative value disables it.
+	StartJitter time.Duration
+	// Probe configures how to check that a service is online.
+	Probe ProbeConfig
 }
 
 type Worker struct {
-	config WorkerConfig
-	cancel context.CancelFunc
+	config   WorkerConfig
+	dialer   Dialer
+	limiter  *connLimiter
+	configCh chan WorkerConfig
+	cancel   context.CancelFunc
 }
 
 var DefaultWorkerConfig = WorkerConfig{
@@ -27,27 +41,26 @@ var DefaultWorkerConfig = WorkerConfig{
 	PingPauseInterval: 5 * time.Minute,
 	PingRetryInterval: 10 * time.Second,
 	PingRetryAttempts: 3,
+	RetryBackoff:      ExponentialBackoff{Max: defaultBackoffMax, Jitter: defaultBackoffJitter},
+	Jitter:            0.1,
+	StartJitter:       30 * time.Second,
+}
+
+// retryInterval returns time to wait before retry `retry` given the previous wait.
+func (c WorkerConfig) retryInterval(retry int, prev time.Duration) time.Duration {
+	backoff := c.RetryBackoff
+	if backoff == nil {
+		backoff = FixedBackoff{}
+	}
+	return backoff.Duration(retry, c.PingRetryInterval, prev)
 }
 
 func (w *Worker) Start(ctx context.Context, url string, outputCh chan<- Event) error {
 	ctx, w.cancel = context.WithCancel(ctx)
 
-	emitStatusEvent := func(err error) {
-		var status Status
-
-		switch err {
-		case nil:
-			status = StatusOnline
-		default:
-			status = StatusOffline
-		}
-
+	emitStatusEvent := func(probe *ProbeResult, times probeTimes, attempts int, err error) {
 		select {
-		case outputCh <- workerStatus{
-			Status: status,
-			URL:    url,
-			Error:  err,
-		}:
+		case outputCh <- newWorkerStatus(url, probe, times, attempts, err):
 		}
 	}
 
@@ -56,21 +69,9 @@ func (w *Worker) Start(ctx context.Context, url string, outputCh chan<- Event) e
 		return err
 	}
 
-	connect := func(host string) error {
-		if err := workerConnSem.Acquire(ctx, 1); err != nil {
-			return err
-		}
-		defer workerConnSem.Release(1)
-
-		ctxReq, cancel := context.WithTimeout(ctx, w.config.PingTimeout)
-		defer cancel()
-
-		conn, err := proxy.Dial(ctxReq, "tcp", host)
-		if err != nil {
-			return err
-		}
-		_ = conn.Close()
-		return nil
+	prober, err := newProber(w.config.Probe, w.dialer)
+	if err != nil {
+		return err
 	}
 
 	defer func() {
@@ -82,53 +83,154 @@ func (w *Worker) Start(ctx context.Context, url string, outputCh chan<- Event) e
 	}()
 
 	failedAttempts := int(0)
-	sleepTime := time.Duration(0)
-	for {
-		select {
-		case <-time.After(sleepTime):
-			sleepTime = w.config.PingInterval
+	retryWait := time.Duration(0)
+	// ping connects to the host, informs process about the result
+	// and returns time to sleep before the next ping.
+	ping := func() time.Duration {
+		probe, times, err := w.connect(ctx, prober, url, host)
 
-			// Connect to the host and inform process about the result
-			err := connect(host)
+		select {
+		case <-ctx.Done():
+			return w.config.PingInterval
+		default:
+		}
 
-			select {
-			case <-ctx.Done():
-				continue
-			default:
+		sleepTime := jitter(w.config.PingInterval, w.config.Jitter)
+		if err != nil {
+			// Handle StatusOffline.
+			// It may be that StatusOffline is only temporary due to network conditions.
+			// To take this into account, the worker issues another request after an interval
+			// given by WORKER_RETRY_BACKOFF, this is repeated until WORKER_PING_RETRY_ATTEMPTS
+			// is reached, after which worker pauses its operation for WORKER_PING_PAUSE.
+			failedAttempts++
+
+			if failedAttempts < w.config.PingRetryAttempts {
+				retryWait = w.config.retryInterval(failedAttempts, retryWait)
+				return retryWait
 			}
 
+			sleepTime = jitter(w.config.PingPauseInterval, w.config.Jitter)
+		}
+
+		attempts := failedAttempts
+		if err == nil {
+			// Count also the successful attempt.
+			attempts++
+		}
+		failedAttempts, retryWait = 0, 0
+		emitStatusEvent(probe, times, attempts, err)
+		return sleepTime
+	}
+
+	// Spread the first pings of workers started at once.
+	next := time.Now().Add(randDuration(w.config.StartJitter))
+	for {
+		select {
+		case <-time.After(time.Until(next)):
+			next = time.Now().Add(ping())
+
+		case cfg := <-w.configCh:
+			// Probes are validated by the scanner, keep the old one just in case.
+			p, err := newProber(cfg.Probe, w.dialer)
 			if err != nil {
-				// Handle StatusOffline.
-				// It may be that StatusOffline is only temporary due to network conditions.
-				// To take this into account, the worker issues another request after WORKER_PING_RETRY_INTERVAL,
-				// this is repeated until WORKER_PING_RETRY_ATTEMPTS is reached, after which worker pauses
-				// its operation for WORKER_PING_PAUSE.
-				failedAttempts++
-
-				if failedAttempts < w.config.PingRetryAttempts {
-					sleepTime = w.config.PingRetryInterval
-					continue
-				}
-
-				sleepTime = w.config.PingPauseInterval
+				continue
+			}
+			w.config, prober = cfg, p
+			// The next ping happens no later than after the new PingInterval.
+			if latest := time.Now().Add(w.config.PingInterval); latest.Before(next) {
+				next = latest
 			}
-
-			failedAttempts = 0
-			emitStatusEvent(err)
 
 		case <-ctx.Done():
-			emitStatusEvent(context.Canceled)
+			emitStatusEvent(nil, probeTimes{}, 0, context.Canceled)
 			return nil
 		}
 	}
 }
 
+// scan checks `url` once. A failed attempt is retried after an interval given
+// by RetryBackoff until PingRetryAttempts is reached.
+func (w *Worker) scan(ctx context.Context, url string) (workerStatus, error) {
+	host, err := ParseHostPort(url)
+	if err != nil {
+		return workerStatus{}, err
+	}
+
+	prober, err := newProber(w.config.Probe, w.dialer)
+	if err != nil {
+		return workerStatus{}, err
+	}
+
+	retryWait := time.Duration(0)
+	for attempts := 1; ; attempts++ {
+		probe, times, err := w.connect(ctx, prober, url, host)
+		if err == nil || attempts >= w.config.PingRetryAttempts {
+			return newWorkerStatus(url, probe, times, attempts, err), nil
+		}
+
+		retryWait = w.config.retryInterval(attempts, retryWait)
+		select {
+		case <-time.After(retryWait):
+		case <-ctx.Done():
+			return newWorkerStatus(url, nil, probeTimes{}, attempts, context.Canceled), nil
+		}
+	}
+}
+
+// connect probes `url` served at address `host`, waiting for a free connection slot first.
+func (w *Worker) connect(ctx context.Context, prober *prober, url, host string) (*ProbeResult, probeTimes, error) {
+	release, err := w.limiter.acquire(ctx, host)
+	if err != nil {
+		return nil, probeTimes{}, err
+	}
+	defer release()
+
+	ctxReq, cancel := context.WithTimeout(ctx, w.config.PingTimeout)
+	defer cancel()
+
+	return prober.probe(ctxReq, url, host)
+}
+
+// Reconfigure makes the worker use configuration `cfg`. It doesn't block,
+// a pending configuration is replaced.
+func (w *Worker) Reconfigure(cfg WorkerConfig) {
+	select {
+	case <-w.configCh:
+	default:
+	}
+	w.configCh <- cfg
+}
+
 func (w *Worker) Stop() {
 	w.cancel()
 }
 
-func newWorker(cfg WorkerConfig) *Worker {
+func newWorkerStatus(url string, probe *ProbeResult, times probeTimes, attempts int, err error) workerStatus {
+	var status Status
+
+	switch err {
+	case nil:
+		status = StatusOnline
+	default:
+		status = StatusOffline
+	}
+
+	return workerStatus{
+		Status:      status,
+		URL:         url,
+		Error:       err,
+		Probe:       probe,
+		ConnectTime: times.connect,
+		TTFB:        times.ttfb,
+		Attempts:    attempts,
+	}
+}
+
+func newWorker(cfg WorkerConfig, dialer Dialer, limiter *connLimiter) *Worker {
 	return &Worker{
-		config: cfg,
+		config:   cfg,
+		dialer:   dialer,
+		limiter:  limiter,
+		configCh: make(chan WorkerConfig, 1),
 	}
 }
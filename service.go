@@ -103,9 +103,28 @@ func (s *Service) Validate() error {
 	return nil
 }
 
+// clone returns a deep copy of the service.
+func (s *Service) clone() *Service {
+	c := *s
+	if s.URLs != nil {
+		c.URLs = append([]string{}, s.URLs...)
+	}
+	if s.PublicKeys != nil {
+		c.PublicKeys = make(PublicKeys, len(s.PublicKeys))
+		for i := range s.PublicKeys {
+			publicKey := *s.PublicKeys[i]
+			c.PublicKeys[i] = &publicKey
+		}
+	}
+	return &c
+}
+
+// defaultValidator is shared by all services, so the schema is loaded only once.
+var defaultValidator = validator.NewValidator(jsonschema.V0)
+
 func NewService(id string) *Service {
 	return &Service{
 		id:        serviceID(id),
-		validator: validator.NewValidator(jsonschema.V0),
+		validator: defaultValidator,
 	}
 }
@@ -1,7 +1,12 @@
 package oniontree
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
+// Tag is a name of a tag. Tags are hierarchical, segments of the name
+// are separated by `/`, e.g. `market/drugs` is a child of tag `market`.
 type Tag string
 
 func (t Tag) String() string {
@@ -9,7 +14,7 @@ func (t Tag) String() string {
 }
 
 func (t Tag) Validate() error {
-	pattern := `^[a-z0-9\-]+$`
+	pattern := `^[a-z0-9\-]+(/[a-z0-9\-]+)*$`
 	matched, err := regexp.MatchString(pattern, string(t))
 	if err != nil {
 		return err
@@ -19,3 +24,17 @@ func (t Tag) Validate() error {
 	}
 	return nil
 }
+
+// Parent returns the parent tag, or an empty tag if `t` is a top-level tag.
+func (t Tag) Parent() Tag {
+	idx := strings.LastIndex(string(t), "/")
+	if idx < 0 {
+		return ""
+	}
+	return t[:idx]
+}
+
+// IsChildOf returns true if `t` is nested under `parent` at any depth.
+func (t Tag) IsChildOf(parent Tag) bool {
+	return strings.HasPrefix(string(t), string(parent)+"/")
+}
@@ -0,0 +1,156 @@
+package oniontree
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// TagMetadata is an optional description of a tag.
+type TagMetadata struct {
+	DisplayName string `json:"display_name,omitempty" yaml:"display_name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Aliases     []Tag  `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Parent      Tag    `json:"parent,omitempty" yaml:"parent,omitempty"`
+}
+
+func (m *TagMetadata) Validate() error {
+	for i := range m.Aliases {
+		if err := m.Aliases[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if m.Parent != "" {
+		if err := m.Parent.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTagMetadata returns metadata of tag `tag`.
+func (o OnionTree) GetTagMetadata(tag Tag) (*TagMetadata, error) {
+	data, err := ioutil.ReadFile(o.tagMetadataPath(tag))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &ErrTagMetadataNotExists{tag}
+		}
+		return nil, err
+	}
+	m := &TagMetadata{}
+	if err := o.unmarshalData(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SetTagMetadata creates or replaces metadata of tag `tag`.
+// The tag itself doesn't need to exist.
+func (o OnionTree) SetTagMetadata(tag Tag, m *TagMetadata) error {
+	if err := tag.Validate(); err != nil {
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	// Walk up the hierarchy to make sure the tag doesn't become its own ancestor.
+	// Metadata edited by hand may already contain a cycle not including the tag.
+	visited := map[Tag]struct{}{}
+	for parent := m.Parent; parent != ""; {
+		if parent == tag {
+			return &ErrTagParentCycle{tag}
+		}
+		if _, ok := visited[parent]; ok {
+			return &ErrTagParentCycle{parent}
+		}
+		visited[parent] = struct{}{}
+		pm, err := o.GetTagMetadata(parent)
+		if err != nil {
+			if _, ok := err.(*ErrTagMetadataNotExists); ok {
+				break
+			}
+			return err
+		}
+		parent = pm.Parent
+	}
+	return o.writeTagMetadata(tag, m)
+}
+
+func (o OnionTree) writeTagMetadata(tag Tag, m *TagMetadata) error {
+	pth := o.tagMetadataPath(tag)
+	if err := os.MkdirAll(path.Dir(pth), 0755); err != nil {
+		return err
+	}
+	data, err := o.marshalData(m)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(pth, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveTagMetadata removes metadata of tag `tag`.
+func (o OnionTree) RemoveTagMetadata(tag Tag) error {
+	if err := os.Remove(o.tagMetadataPath(tag)); err != nil {
+		if os.IsNotExist(err) {
+			return &ErrTagMetadataNotExists{tag}
+		}
+		return err
+	}
+	return nil
+}
+
+// replaceTagParents sets parent of tags whose parent is `oldTag`, or nested in it,
+// to `newTag`. An empty `newTag` clears the parent.
+func (o OnionTree) replaceTagParents(oldTag, newTag Tag) error {
+	err := filepath.Walk(o.TagsDir(), func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(pth) != "."+o.format {
+			return nil
+		}
+		pthRel, err := filepath.Rel(o.TagsDir(), pth)
+		if err != nil {
+			return err
+		}
+		tag := Tag(o.filenameToId(pthRel))
+		m, err := o.GetTagMetadata(tag)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case m.Parent == oldTag:
+			m.Parent = newTag
+		case m.Parent.IsChildOf(oldTag) && newTag != "":
+			m.Parent = newTag + m.Parent[len(oldTag):]
+		case m.Parent.IsChildOf(oldTag):
+			m.Parent = ""
+		default:
+			return nil
+		}
+		return o.writeTagMetadata(tag, m)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// TagsDir returns a directory with tag metadata files.
+func (o OnionTree) TagsDir() string {
+	return path.Join(o.dir, "tags")
+}
+
+func (o OnionTree) tagMetadataPath(tag Tag) string {
+	return path.Join(o.TagsDir(), o.idToFilename(tag.String()))
+}
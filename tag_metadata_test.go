@@ -0,0 +1,81 @@
+package oniontree_test
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestOnionTree_TagMetadata(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	tag := oniontree.Tag("market")
+
+	_, err := ot.GetTagMetadata(tag)
+	if !assert.IsType(t, &oniontree.ErrTagMetadataNotExists{}, err) {
+		t.Fatal("unexpected error", err)
+	}
+
+	metadata := &oniontree.TagMetadata{
+		DisplayName: "Markets",
+		Description: "Darknet markets.",
+		Aliases:     []oniontree.Tag{"shop"},
+		Parent:      "commerce",
+	}
+	if err := ot.SetTagMetadata(tag, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.FileExists(t, ot.TagsDir()+"/market.yaml") {
+		t.Fatal("file 'market.yaml' does not exist")
+	}
+
+	result, err := ot.GetTagMetadata(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, metadata, result)
+
+	if err := ot.RemoveTagMetadata(tag); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ot.GetTagMetadata(tag)
+	assert.IsType(t, &oniontree.ErrTagMetadataNotExists{}, err)
+}
+
+func TestOnionTree_SetTagMetadataErrorInvalid(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	err := ot.SetTagMetadata("market", &oniontree.TagMetadata{Aliases: []oniontree.Tag{"Shop"}})
+	assert.IsType(t, &oniontree.ErrInvalidTagName{}, err)
+
+	if err := ot.SetTagMetadata("commerce", &oniontree.TagMetadata{Parent: "market"}); err != nil {
+		t.Fatal(err)
+	}
+	err = ot.SetTagMetadata("market", &oniontree.TagMetadata{Parent: "commerce"})
+	assert.IsType(t, &oniontree.ErrTagParentCycle{}, err)
+}
+
+func TestOnionTree_SetTagMetadataErrorExistingCycle(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	// Tags `a` and `b` are each other's parent, as if edited by hand.
+	if err := os.MkdirAll(ot.TagsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tag, parent := range map[string]string{"a": "b", "b": "a"} {
+		data := []byte("parent: " + parent + "\n")
+		if err := ioutil.WriteFile(path.Join(ot.TagsDir(), tag+".yaml"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := ot.SetTagMetadata("c", &oniontree.TagMetadata{Parent: "a"})
+	assert.IsType(t, &oniontree.ErrTagParentCycle{}, err)
+	assert.NoFileExists(t, path.Join(ot.TagsDir(), "c.yaml"))
+}
@@ -0,0 +1,221 @@
+package oniontree_test
+
+import (
+	"github.com/oniontree-org/go-oniontree"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTag_Validate(t *testing.T) {
+	for _, tag := range []oniontree.Tag{"market", "market/drugs", "a/b-c/d0"} {
+		assert.NoError(t, tag.Validate(), tag)
+	}
+	for _, tag := range []oniontree.Tag{"", "/market", "market/", "market//drugs", "../market", "Market"} {
+		assert.IsType(t, &oniontree.ErrInvalidTagName{}, tag.Validate(), tag)
+	}
+}
+
+func TestTag_Parent(t *testing.T) {
+	assert.Equal(t, oniontree.Tag(""), oniontree.Tag("market").Parent())
+	assert.Equal(t, oniontree.Tag("market"), oniontree.Tag("market/drugs").Parent())
+	assert.True(t, oniontree.Tag("market/drugs/pills").IsChildOf("market"))
+	assert.False(t, oniontree.Tag("marketplace").IsChildOf("market"))
+}
+
+func TestOnionTree_HierarchicalTags(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addServices(t, ot, 3)
+
+	if err := ot.TagService("service-0", []oniontree.Tag{"market/drugs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ot.TagService("service-1", []oniontree.Tag{"market"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ot.TagService("service-2", []oniontree.Tag{"shop"}); err != nil {
+		t.Fatal(err)
+	}
+	// Tag `shop` is a child of `market` by its metadata.
+	if err := ot.SetTagMetadata("shop", &oniontree.TagMetadata{Parent: "market"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := ot.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"link_list", "market", "market/drugs", "shop"}, tags)
+
+	serviceIDs, err := ot.ListServicesWithTag("market")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"service-1"}, serviceIDs)
+
+	serviceIDs, err = ot.ListServicesWithTagRecursive("market")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"service-0", "service-1", "service-2"}, serviceIDs)
+
+	tags, err = ot.ListServiceTags("service-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"market/drugs"}, tags)
+
+	// Empty tag directories are removed up the hierarchy.
+	if err := ot.UntagService("service-0", []oniontree.Tag{"market/drugs"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoDirExists(t, ot.TaggedDir()+"/market/drugs")
+	assert.DirExists(t, ot.TaggedDir()+"/market")
+	if err := ot.UntagService("service-1", []oniontree.Tag{"market"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoDirExists(t, ot.TaggedDir()+"/market")
+
+	_, err = ot.ListServicesWithTagRecursive("nonexistent")
+	assert.IsType(t, &oniontree.ErrTagNotExists{}, err)
+}
+
+func TestOnionTree_RenameTag(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	addServices(t, ot, 2)
+	if err := ot.TagService("service-0", []oniontree.Tag{"market", "market/drugs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ot.TagService("service-1", []oniontree.Tag{"market/drugs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ot.SetTagMetadata("market/drugs", &oniontree.TagMetadata{Description: "Drugs."}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename to the same depth.
+	if err := ot.RenameTag("link_list", "links"); err != nil {
+		t.Fatal(err)
+	}
+	// Rename to a different depth, including nested tags.
+	if err := ot.RenameTag("market", "commerce/markets"); err != nil {
+		t.Fatal(err)
+	}
+	// Rename a nested tag to the top level.
+	if err := ot.RenameTag("commerce/markets/drugs", "drugs"); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := ot.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"commerce", "commerce/markets", "drugs", "links"}, tags)
+
+	for tag, expected := range map[oniontree.Tag][]string{
+		"links":            {"oniontree"},
+		"commerce/markets": {"service-0"},
+		"drugs":            {"service-0", "service-1"},
+	} {
+		serviceIDs, err := ot.ListServicesWithTag(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, serviceIDs, tag)
+
+		// Links must point to the service files.
+		for _, id := range serviceIDs {
+			assert.FileExists(t, ot.TaggedDir()+"/"+tag.String()+"/"+id+".yaml")
+		}
+	}
+
+	metadata, err := ot.GetTagMetadata("drugs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Drugs.", metadata.Description)
+
+	err = ot.RenameTag("nonexistent", "tag")
+	assert.IsType(t, &oniontree.ErrTagNotExists{}, err)
+	err = ot.RenameTag("drugs", "links")
+	assert.IsType(t, &oniontree.ErrTagExists{}, err)
+	err = ot.RenameTag("commerce", "commerce/markets/commerce")
+	assert.IsType(t, &oniontree.ErrTagParentCycle{}, err)
+}
+
+func TestOnionTree_DeleteTag(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	if err := ot.TagService("oniontree", []oniontree.Tag{"market/drugs", "directory"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ot.SetTagMetadata("market/drugs", &oniontree.TagMetadata{Description: "Drugs."}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ot.DeleteTag("market/drugs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ot.DeleteTag("link_list"); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := ot.ListServiceTags("oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []oniontree.Tag{"directory"}, tags)
+	assert.NoDirExists(t, ot.TaggedDir()+"/market")
+
+	_, err = ot.GetTagMetadata("market/drugs")
+	assert.IsType(t, &oniontree.ErrTagMetadataNotExists{}, err)
+
+	err = ot.DeleteTag("link_list")
+	assert.IsType(t, &oniontree.ErrTagNotExists{}, err)
+	err = ot.DeleteTag("..")
+	assert.IsType(t, &oniontree.ErrTagNotExists{}, err)
+}
+
+func TestOnionTree_RenameDeleteTagParents(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	if err := ot.TagService("oniontree", []oniontree.Tag{"market/drugs"}); err != nil {
+		t.Fatal(err)
+	}
+	for tag, parent := range map[oniontree.Tag]oniontree.Tag{
+		"pills":  "market/drugs",
+		"shops":  "market",
+		"guides": "directory",
+	} {
+		if err := ot.SetTagMetadata(tag, &oniontree.TagMetadata{Parent: parent}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustParent := func(tag, expected oniontree.Tag) {
+		metadata, err := ot.GetTagMetadata(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, metadata.Parent, tag)
+	}
+
+	if err := ot.RenameTag("market", "commerce/markets"); err != nil {
+		t.Fatal(err)
+	}
+	mustParent("pills", "commerce/markets/drugs")
+	mustParent("shops", "commerce/markets")
+	mustParent("guides", "directory")
+
+	if err := ot.DeleteTag("commerce"); err != nil {
+		t.Fatal(err)
+	}
+	mustParent("pills", "")
+	mustParent("shops", "")
+	mustParent("guides", "directory")
+}
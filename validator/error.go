@@ -13,3 +13,8 @@ func (e *ValidatorError) Error() string {
 	}
 	return strings.Join(s, "\n")
 }
+
+// Errors returns the individual validation errors.
+func (e *ValidatorError) Errors() []error {
+	return e.errs
+}
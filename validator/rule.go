@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type Severity uint8
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityOff:
+		return "off"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return ""
+}
+
+const (
+	SeverityOff Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func ParseSeverity(s string) (Severity, error) {
+	for _, severity := range []Severity{SeverityOff, SeverityWarning, SeverityError} {
+		if severity.String() == s {
+			return severity, nil
+		}
+	}
+	return SeverityOff, fmt.Errorf("invalid severity `%s`", s)
+}
+
+// RuleFunc returns an error if `value` violates the rule.
+type RuleFunc func(value interface{}) error
+
+type rule struct {
+	fn       RuleFunc
+	severity Severity
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = make(map[string]*rule)
+)
+
+// RegisterRule makes a rule available under `name`. Parameter `severity`
+// is used unless a validator overrides it. If RegisterRule is called twice
+// with the same name, it panics.
+func RegisterRule(name string, severity Severity, fn RuleFunc) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	if _, ok := rules[name]; ok {
+		panic("validator: RegisterRule called twice for rule " + name)
+	}
+	rules[name] = &rule{
+		fn:       fn,
+		severity: severity,
+	}
+}
+
+// Rules returns a sorted list of names of the registered rules.
+func Rules() []string {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getRule(name string) (*rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	r, ok := rules[name]
+	return r, ok
+}
+
+type RuleError struct {
+	Rule     string
+	Severity Severity
+	Err      error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Rule, e.Err)
+}
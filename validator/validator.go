@@ -3,23 +3,103 @@ package validator
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/xeipuuv/gojsonschema"
+	"sort"
 )
 
+// Validator validates values against a JSON schema. The schema is compiled
+// once in NewValidator, the validator is safe for concurrent use.
 type Validator struct {
-	schema string
+	schema *gojsonschema.Schema
+	// err holds an error encountered while compiling the schema.
+	err error
+	// rules maps names of rules run alongside the schema to their severity.
+	rules map[string]Severity
 }
 
+// Validate validates `value` encoded as JSON and runs rules with SeverityError.
 func (v Validator) Validate(value interface{}) error {
+	_, err := v.Lint(value)
+	return err
+}
+
+// Lint validates `value` like Validate does and returns failures of rules
+// with SeverityWarning separately.
+func (v Validator) Lint(value interface{}) ([]*RuleError, error) {
 	b, err := json.Marshal(value)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	errs := []error{}
+	if err := v.ValidateBytes(b); err != nil {
+		e, ok := err.(*ValidatorError)
+		if !ok {
+			return nil, err
+		}
+		errs = append(errs, e.errs...)
+	}
+
+	names := make([]string, 0, len(v.rules))
+	for name := range v.rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	warnings := []*RuleError{}
+	for _, name := range names {
+		severity := v.rules[name]
+		r, ok := getRule(name)
+		if !ok || severity == SeverityOff {
+			continue
+		}
+		if err := r.fn(value); err != nil {
+			ruleErr := &RuleError{
+				Rule:     name,
+				Severity: severity,
+				Err:      err,
+			}
+			if severity == SeverityError {
+				errs = append(errs, ruleErr)
+				continue
+			}
+			warnings = append(warnings, ruleErr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return warnings, &ValidatorError{errs}
+	}
+	return warnings, nil
+}
+
+// WithRules returns a copy of the validator running all registered rules
+// alongside the schema. Severities in `severities` override the default ones.
+func (v Validator) WithRules(severities map[string]Severity) (*Validator, error) {
+	v.rules = map[string]Severity{}
+	for _, name := range Rules() {
+		r, _ := getRule(name)
+		v.rules[name] = r.severity
+	}
+	for name, severity := range severities {
+		if _, ok := v.rules[name]; !ok {
+			return nil, fmt.Errorf("rule `%s` is not registered", name)
+		}
+		v.rules[name] = severity
 	}
+	return &v, nil
+}
 
-	schemaLoader := gojsonschema.NewStringLoader(v.schema)
-	documentLoader := gojsonschema.NewBytesLoader(b)
+// ValidateBytes validates JSON document `b` against the schema, rules are not run.
+// It only accepts JSON, service files are YAML and Validate marshals them to JSON
+// anyway, hence it saves the json.Marshal call only to callers already holding JSON.
+func (v Validator) ValidateBytes(b []byte) error {
+	if v.err != nil {
+		return v.err
+	}
 
-	res, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	res, err := v.schema.Validate(gojsonschema.NewBytesLoader(b))
 	if err != nil {
 		return err
 	}
@@ -38,8 +118,12 @@ func (v Validator) Validate(value interface{}) error {
 	return nil
 }
 
+// NewValidator returns a new Validator. If the schema cannot be compiled,
+// the error is returned by every call to Validate.
 func NewValidator(schema string) *Validator {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
 	return &Validator{
-		schema: schema,
+		schema: s,
+		err:    err,
 	}
 }
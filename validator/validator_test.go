@@ -0,0 +1,127 @@
+package validator_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/oniontree-org/go-oniontree/validator"
+	"github.com/oniontree-org/go-oniontree/validator/jsonschema"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+type service struct {
+	Name string   `json:"name"`
+	URLs []string `json:"urls"`
+}
+
+func TestValidator_ValidateBytes(t *testing.T) {
+	v := validator.NewValidator(jsonschema.V0)
+
+	assert.NoError(t, v.ValidateBytes([]byte(`{"name":"OnionTree","urls":["http://onions53ehmf4q75.onion"]}`)))
+
+	err := v.ValidateBytes([]byte(`{"name":"OnionTree","urls":[]}`))
+	assert.IsType(t, &validator.ValidatorError{}, err)
+
+	err = v.ValidateBytes([]byte(`{"name":`))
+	assert.Error(t, err)
+}
+
+func TestValidator_ValidateConcurrent(t *testing.T) {
+	v := validator.NewValidator(jsonschema.V0)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					assert.NoError(t, v.Validate(service{"OnionTree", []string{"http://onions53ehmf4q75.onion"}}))
+				} else {
+					assert.Error(t, v.Validate(service{"OnionTree", []string{"http://clearnet.com"}}))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestNewValidator_ErrorInvalidSchema(t *testing.T) {
+	v := validator.NewValidator(`{"type": 1}`)
+	assert.Error(t, v.Validate(service{}))
+}
+
+func BenchmarkValidator_Validate(b *testing.B) {
+	v := validator.NewValidator(jsonschema.V0)
+	s := service{"OnionTree", []string{"http://onions53ehmf4q75.onion"}}
+
+	for i := 0; i < b.N; i++ {
+		if err := v.Validate(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValidator_ValidateBytes(b *testing.B) {
+	v := validator.NewValidator(jsonschema.V0)
+	data, err := json.Marshal(service{"OnionTree", []string{"http://onions53ehmf4q75.onion"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		if err := v.ValidateBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestValidator_Lint(t *testing.T) {
+	validator.RegisterRule("test-no-default-name", validator.SeverityWarning, func(value interface{}) error {
+		if value.(service).Name == "Default" {
+			return errors.New("default name")
+		}
+		return nil
+	})
+	validator.RegisterRule("test-single-url", validator.SeverityOff, func(value interface{}) error {
+		if len(value.(service).URLs) != 1 {
+			return errors.New("multiple URLs")
+		}
+		return nil
+	})
+
+	v := validator.NewValidator(jsonschema.V0)
+	s := service{"Default", []string{"http://first.onion", "http://second.onion"}}
+
+	// Rules are not run unless enabled.
+	warnings, err := v.Lint(s)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	v, err = v.WithRules(map[string]validator.Severity{
+		"test-single-url": validator.SeverityError,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warnings, err = v.Lint(s)
+	if !assert.Len(t, warnings, 1) {
+		t.Fatal("unexpected warnings")
+	}
+	assert.Equal(t, "test-no-default-name", warnings[0].Rule)
+	if !assert.IsType(t, &validator.ValidatorError{}, err) {
+		t.Fatal("unexpected error")
+	}
+	errs := err.(*validator.ValidatorError).Errors()
+	if !assert.Len(t, errs, 1) {
+		t.Fatal("unexpected errors")
+	}
+	assert.Equal(t, "test-single-url", errs[0].(*validator.RuleError).Rule)
+
+	_, err = v.WithRules(map[string]validator.Severity{
+		"nonexistent": validator.SeverityError,
+	})
+	assert.Error(t, err)
+}
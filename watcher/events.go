@@ -24,6 +24,21 @@ type (
 		ID  string
 		Tag string
 	}
+
+	// TagRemoved is emitted when a tag directory is moved away at once,
+	// e.g. when the tag is renamed or deleted. It's preceded by
+	// ServiceUntagged events for all services tagged with the tag.
+	TagRemoved struct {
+		Tag string
+	}
+
+	// TagRenamed is emitted when a tag directory moved away reappears under
+	// another name with the same nested tags and services, following TagRemoved
+	// and ServiceTagged events. Nested tags are renamed along with the tag.
+	TagRenamed struct {
+		Old string
+		New string
+	}
 )
 
 type (
@@ -5,11 +5,20 @@ import (
 	"fmt"
 	"github.com/fsnotify/fsnotify"
 	"github.com/oniontree-org/go-oniontree"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
+// renameWindow is the longest time between a tag directory being moved away
+// and appearing under another name for the move to be reported as TagRenamed.
+const renameWindow = 2 * time.Second
+
 type Watcher struct {
 	ot *oniontree.OnionTree
 }
@@ -28,6 +37,10 @@ func (w *Watcher) watchTagged(
 	}
 	fsEventToTagEvent := func(e fsnotify.Event) Event {
 		tagName := filenameToTagName(e.Name)
+		// Hidden directories are used for temporary data.
+		if strings.HasPrefix(tagName, ".") {
+			return nil
+		}
 		switch e.Op {
 		case fsnotify.Create:
 			return tagCreated{
@@ -87,45 +100,295 @@ func (w *Watcher) watchTags(
 		return strings.TrimSuffix(f, filepath.Ext(f))
 	}
 	filenameToTagName := func(f string) string {
-		return path.Base(path.Dir(f))
+		tagName, err := filepath.Rel(w.ot.TaggedDir(), f)
+		if err != nil {
+			return ""
+		}
+		return filepath.ToSlash(tagName)
 	}
-	fsEventToServiceEvent := func(e fsnotify.Event) Event {
-		tagName := filenameToTagName(e.Name)
-		serviceID := filenameToServiceID(e.Name)
-		// If tag name is named "tagged", it means the tag directory itself
-		// was removed. Such event must not be forwarded.
-		if tagName == "tagged" {
+	// isTagDir distinguishes nested tag directories from symbolic links to services.
+	// It doesn't look at the file itself since it may be already removed, but relies
+	// on the fact that service filenames have an extension, while tag names cannot
+	// contain a dot.
+	isTagDir := func(f string) bool {
+		return filepath.Ext(f) == ""
+	}
+
+	tagsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer tagsWatcher.Close()
+
+	// Format: tagged[tagName][serviceID]
+	// Keeps track of tags being watched and services tagged with them,
+	// so that services can be untagged when the whole tag directory is gone.
+	tagged := map[string]map[string]struct{}{}
+
+	tagService := func(serviceID, tagName string) {
+		if _, ok := tagged[tagName]; !ok {
+			return
+		}
+		tagged[tagName][serviceID] = struct{}{}
+		emitEvent(ServiceTagged{
+			ID:  serviceID,
+			Tag: tagName,
+		})
+	}
+	// tagSnapshot holds services of a tag and its nested tags.
+	type tagSnapshot struct {
+		tagName string
+		time    time.Time
+		// Format: tags[relativeTagName][serviceID], "" being the tag itself
+		tags map[string]map[string]struct{}
+	}
+	// Tags recently moved away and created, ordered by time, to be matched into renames.
+	movedTags, createdTags := []tagSnapshot{}, []tagSnapshot{}
+
+	snapshotTag := func(tagName string) tagSnapshot {
+		s := tagSnapshot{
+			tagName: tagName,
+			time:    time.Now(),
+			tags:    map[string]map[string]struct{}{},
+		}
+		for t, serviceIDs := range tagged {
+			if t != tagName && !oniontree.Tag(t).IsChildOf(oniontree.Tag(tagName)) {
+				continue
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(t, tagName), "/")
+			s.tags[rel] = map[string]struct{}{}
+			for serviceID := range serviceIDs {
+				s.tags[rel][serviceID] = struct{}{}
+			}
+		}
+		return s
+	}
+	// subtree returns tags of snapshot `s` nested in `rel`, relative to it.
+	subtree := func(s tagSnapshot, rel string) map[string]map[string]struct{} {
+		tags := map[string]map[string]struct{}{}
+		for t, serviceIDs := range s.tags {
+			switch {
+			case t == rel:
+				tags[""] = serviceIDs
+			case rel == "":
+				tags[t] = serviceIDs
+			case strings.HasPrefix(t, rel+"/"):
+				tags[strings.TrimPrefix(t, rel+"/")] = serviceIDs
+			}
+		}
+		return tags
+	}
+	hasServices := func(tags map[string]map[string]struct{}) bool {
+		for _, serviceIDs := range tags {
+			if len(serviceIDs) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	// matchRenamedTags emits TagRenamed for each moved tag whose services
+	// appeared under a newly created tag.
+	matchRenamedTags := func() {
+		now := time.Now()
+		prune := func(snapshots []tagSnapshot) []tagSnapshot {
+			for len(snapshots) > 0 && now.Sub(snapshots[0].time) > renameWindow {
+				snapshots = snapshots[1:]
+			}
+			return snapshots
+		}
+		movedTags, createdTags = prune(movedTags), prune(createdTags)
+
+		unmatched := []tagSnapshot{}
+	moved:
+		for _, m := range movedTags {
+			if !hasServices(m.tags) {
+				continue
+			}
+			for _, c := range createdTags {
+				// The created tag may have changed since, or be gone already.
+				if _, ok := tagged[c.tagName]; !ok || c.tagName == m.tagName {
+					continue
+				}
+				c = snapshotTag(c.tagName)
+				for rel := range c.tags {
+					if !reflect.DeepEqual(subtree(c, rel), m.tags) {
+						continue
+					}
+					emitEvent(TagRenamed{
+						Old: m.tagName,
+						New: path.Join(c.tagName, rel),
+					})
+					continue moved
+				}
+			}
+			unmatched = append(unmatched, m)
+		}
+		movedTags = unmatched
+	}
+
+	untagService := func(serviceID, tagName string) {
+		if _, ok := tagged[tagName][serviceID]; !ok {
+			// Either the service was never tagged or the tag was already removed.
+			return
+		}
+		delete(tagged[tagName], serviceID)
+		emitEvent(ServiceUntagged{
+			ID:  serviceID,
+			Tag: tagName,
+		})
+	}
+	// removeTag untags services tagged with `tagName` and its nested tags.
+	// If `moved` is true, the tag directory was moved away at once, e.g.
+	// the tag was renamed or deleted, and TagRemoved is emitted.
+	removeTag := func(tagName string, moved bool) {
+		if moved {
+			movedTags = append(movedTags, snapshotTag(tagName))
+			defer matchRenamedTags()
+		}
+		tagNames := []string{}
+		for t := range tagged {
+			if t == tagName || oniontree.Tag(t).IsChildOf(oniontree.Tag(tagName)) {
+				tagNames = append(tagNames, t)
+			}
+		}
+		sort.Strings(tagNames)
+		for _, t := range tagNames {
+			serviceIDs := make([]string, 0, len(tagged[t]))
+			for serviceID := range tagged[t] {
+				serviceIDs = append(serviceIDs, serviceID)
+			}
+			sort.Strings(serviceIDs)
+			for _, serviceID := range serviceIDs {
+				untagService(serviceID, t)
+			}
+			delete(tagged, t)
+			if moved {
+				// The watch is intentionally not removed. A directory moved within
+				// the tree keeps its inode, and the watch may be already shared with
+				// the tag at the new location.
+				emitEvent(TagRemoved{
+					Tag: t,
+				})
+			}
+		}
+	}
+	// watchTag starts watching tag directory `tagName`. If `isNew` is set,
+	// the services found in the directory are treated as newly tagged.
+	var watchTag func(tagName string, isNew bool) error
+	watchTag = func(tagName string, isNew bool) error {
+		// WARNING: There's a lingering race condition!
+		//
+		// If a service is tagged with a tag that didn't exist before,
+		// a new directory `tagged/{foo}` is created, followed by a symbolic link
+		// `tagged/{foo}/{bar}.yaml`. The newly created directory is added to the watch list,
+		// however, the symbolic link may be created long before that happens, and create
+		// event gets lost.
+		//
+		// A duct-tape solution is to look into the directory immediately after it's created
+		// and treat all the files found there as a new tag and emit the event for each one of them.
+		// Only after that add the directory to the watch list. This doesn't prevent the race
+		// condition but lowers the likelihood.
+		//
+		// The same applies to nested tag directories, which may be created
+		// all at once, e.g. `tagged/{foo}/{baz}`.
+		//
+		// The race condition may manifest itself as:
+		//
+		// * Emitted duplicate ServiceTagged events.
+		// * Lost ServiceTagged event.
+		serviceIDs, err := w.ot.ListServicesWithTag(oniontree.Tag(tagName))
+		if err != nil {
+			if _, ok := err.(*oniontree.ErrTagNotExists); ok {
+				// The directory is already gone.
+				return nil
+			}
+			return err
+		}
+
+		if _, ok := tagged[tagName]; !ok {
+			tagged[tagName] = map[string]struct{}{}
+		}
+		for i := range serviceIDs {
+			if isNew {
+				tagService(serviceIDs[i], tagName)
+				continue
+			}
+			tagged[tagName][serviceIDs[i]] = struct{}{}
+		}
+
+		// Start watching the tag directory
+		pth := path.Join(w.ot.TaggedDir(), tagName)
+		if err := tagsWatcher.Add(pth); err != nil {
+			if os.IsNotExist(err) {
+				// The directory was removed in the meantime.
+				return nil
+			}
+			return err
+		}
+
+		files, err := ioutil.ReadDir(pth)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		for i := range files {
+			if !files[i].IsDir() || strings.HasPrefix(files[i].Name(), ".") {
+				continue
+			}
+			if err := watchTag(path.Join(tagName, files[i].Name()), isNew); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// createTag starts watching newly created tag directory `tagName`.
+	createTag := func(tagName string) error {
+		if err := watchTag(tagName, true); err != nil {
+			return err
+		}
+		createdTags = append(createdTags, snapshotTag(tagName))
+		matchRenamedTags()
+		return nil
+	}
+	handleFsEvent := func(e fsnotify.Event) error {
+		// Hidden directories are used for temporary data.
+		if strings.HasPrefix(path.Base(e.Name), ".") {
+			return nil
+		}
+		if isTagDir(e.Name) {
+			tagName := filenameToTagName(e.Name)
+			switch {
+			case e.Op&fsnotify.Create == fsnotify.Create:
+				return createTag(tagName)
+			case e.Op&fsnotify.Rename == fsnotify.Rename:
+				removeTag(tagName, true)
+			case e.Op&fsnotify.Remove == fsnotify.Remove:
+				// Removal of a tag directory is usually preceded by removal
+				// of all the links in it.
+				removeTag(tagName, false)
+			}
 			return nil
 		}
+		tagName := filenameToTagName(path.Dir(e.Name))
+		serviceID := filenameToServiceID(e.Name)
 		switch e.Op {
 		case fsnotify.Create:
-			return ServiceTagged{
-				ID:  serviceID,
-				Tag: tagName,
-			}
+			tagService(serviceID, tagName)
 		case fsnotify.Remove:
-			return ServiceUntagged{
-				ID:  serviceID,
-				Tag: tagName,
-			}
+			untagService(serviceID, tagName)
 		}
 		return nil
 	}
 
-	tagsWatcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	defer tagsWatcher.Close()
-
 	tags, err := w.ot.ListTags()
 	if err != nil {
 		return err
 	}
 
 	for i := range tags {
-		pth := path.Join(w.ot.TaggedDir(), tags[i].String())
-		if err := tagsWatcher.Add(pth); err != nil {
+		if err := watchTag(tags[i].String(), false); err != nil {
 			return err
 		}
 	}
@@ -135,45 +398,14 @@ func (w *Watcher) watchTags(
 		case e := <-taggedEventCh:
 			switch t := e.(type) {
 			case tagCreated:
-				// WARNING: There's a lingering race condition!
-				//
-				// If a service is tagged with a tag that didn't exist before,
-				// a new directory `tagged/{foo}` is created, followed by a symbolic link
-				// `tagged/{foo}/{bar}.yaml`. The newly created directory is added to the watch list,
-				// however, the symbolic link may be created long before that happens, and create
-				// event gets lost.
-				//
-				// A duct-tape solution is to look into the directory immediately after it's created
-				// and treat all the files found there as a new tag and emit the event for each one of them.
-				// Only after that add the directory to the watch list. This doesn't prevent the race
-				// condition but lowers the likelihood.
-				//
-				// The race condition may manifest itself as:
-				//
-				// * Emitted duplicate ServiceTagged events.
-				// * Lost ServiceTagged event.
-				serviceIDs, err := w.ot.ListServicesWithTag(oniontree.Tag(t.Name))
-				if err != nil {
-					return err
-				}
-
-				for i := range serviceIDs {
-					emitEvent(ServiceTagged{
-						ID:  serviceIDs[i],
-						Tag: t.Name,
-					})
-				}
-
-				// Start watching newly created tag directory
-				pth := path.Join(w.ot.TaggedDir(), t.Name)
-				if err := tagsWatcher.Add(pth); err != nil {
+				if err := createTag(t.Name); err != nil {
 					return err
 				}
 			}
 
 		case e := <-tagsWatcher.Events:
-			if event := fsEventToServiceEvent(e); event != nil {
-				emitEvent(event)
+			if err := handleFsEvent(e); err != nil {
+				return err
 			}
 
 		case err := <-tagsWatcher.Errors:
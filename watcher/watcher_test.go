@@ -39,6 +39,21 @@ func mustEvent(t *testing.T, event Event, eventCh <-chan Event) {
 	}
 }
 
+func mustEvents(t *testing.T, events []Event, eventCh <-chan Event) {
+	received := make([]Event, 0, len(events))
+	for len(received) < len(events) {
+		select {
+		case e := <-eventCh:
+			received = append(received, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, received: %v", received)
+		}
+	}
+	if !assert.ElementsMatch(t, events, received) {
+		t.Fatal("unexpected events")
+	}
+}
+
 func mustAddService(t *testing.T, ot *oniontree.OnionTree, eventCh <-chan Event) {
 	serviceID := "testservice"
 	service := oniontree.NewService(serviceID)
@@ -115,3 +130,158 @@ func TestWatcher_Watch(t *testing.T) {
 	mustTagService(t, ot, eventCh)
 	mustRemoveService(t, ot, eventCh)
 }
+
+func TestWatcher_WatchNestedTags(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	w := NewWatcher(ot)
+
+	eventCh := make(chan Event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := w.Watch(ctx, eventCh); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	// Make sure the watcher gets enough time to actually start watching
+	// the directories.
+	time.Sleep(1 * time.Second)
+
+	mustAddService(t, ot, eventCh)
+
+	serviceID := "testservice"
+	for _, tagName := range []string{"market/drugs", "market/drugs/pills", "market"} {
+		if err := ot.TagService(serviceID, []oniontree.Tag{oniontree.Tag(tagName)}); err != nil {
+			t.Fatal(err)
+		}
+		mustEvent(t, ServiceTagged{
+			ID:  serviceID,
+			Tag: tagName,
+		}, eventCh)
+	}
+
+	for _, tagName := range []string{"market/drugs/pills", "market/drugs", "market"} {
+		if err := ot.UntagService(serviceID, []oniontree.Tag{oniontree.Tag(tagName)}); err != nil {
+			t.Fatal(err)
+		}
+		mustEvent(t, ServiceUntagged{
+			ID:  serviceID,
+			Tag: tagName,
+		}, eventCh)
+	}
+}
+
+func TestWatcher_WatchRenameDeleteTag(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	w := NewWatcher(ot)
+
+	eventCh := make(chan Event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := w.Watch(ctx, eventCh); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	// Make sure the watcher gets enough time to actually start watching
+	// the directories.
+	time.Sleep(1 * time.Second)
+
+	mustAddService(t, ot, eventCh)
+
+	serviceID := "testservice"
+	for _, tagName := range []string{"market", "market/drugs"} {
+		if err := ot.TagService(serviceID, []oniontree.Tag{oniontree.Tag(tagName)}); err != nil {
+			t.Fatal(err)
+		}
+		mustEvent(t, ServiceTagged{
+			ID:  serviceID,
+			Tag: tagName,
+		}, eventCh)
+	}
+
+	// Events for the old and the new tag are emitted by different goroutines,
+	// hence their mutual order is not guaranteed.
+	if err := ot.RenameTag("market", "shop"); err != nil {
+		t.Fatal(err)
+	}
+	mustEvents(t, []Event{
+		ServiceUntagged{ID: serviceID, Tag: "market"},
+		TagRemoved{Tag: "market"},
+		ServiceUntagged{ID: serviceID, Tag: "market/drugs"},
+		TagRemoved{Tag: "market/drugs"},
+		ServiceTagged{ID: serviceID, Tag: "shop"},
+		ServiceTagged{ID: serviceID, Tag: "shop/drugs"},
+		TagRenamed{Old: "market", New: "shop"},
+	}, eventCh)
+
+	if err := ot.DeleteTag("shop"); err != nil {
+		t.Fatal(err)
+	}
+	mustEvents(t, []Event{
+		ServiceUntagged{ID: serviceID, Tag: "shop"},
+		TagRemoved{Tag: "shop"},
+		ServiceUntagged{ID: serviceID, Tag: "shop/drugs"},
+		TagRemoved{Tag: "shop/drugs"},
+	}, eventCh)
+}
+
+func TestWatcher_WatchRenameTagDepth(t *testing.T) {
+	ot, cleanup := copyOnionTree(t)
+	defer cleanup()
+
+	w := NewWatcher(ot)
+
+	eventCh := make(chan Event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := w.Watch(ctx, eventCh); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	// Make sure the watcher gets enough time to actually start watching
+	// the directories.
+	time.Sleep(1 * time.Second)
+
+	mustAddService(t, ot, eventCh)
+
+	serviceID := "testservice"
+	if err := ot.TagService(serviceID, []oniontree.Tag{"market/drugs"}); err != nil {
+		t.Fatal(err)
+	}
+	mustEvent(t, ServiceTagged{
+		ID:  serviceID,
+		Tag: "market/drugs",
+	}, eventCh)
+
+	if err := ot.RenameTag("market", "commerce/markets"); err != nil {
+		t.Fatal(err)
+	}
+	// Services of the new tag may be reported more than once, wait for the rename.
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-eventCh:
+			if e, ok := e.(TagRenamed); ok {
+				assert.Equal(t, TagRenamed{Old: "market", New: "commerce/markets"}, e)
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for TagRenamed")
+		}
+	}
+}